@@ -2,7 +2,11 @@ package microstellar
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/stellar/go/clients/horizon"
 )
 
@@ -24,6 +28,17 @@ type Balance struct {
 	Asset  *Asset `json:"asset"`
 	Amount string `json:"amount"`
 	Limit  string `json:"limit"`
+
+	// Amounts reserved by open offers.
+	BuyingLiabilities  string `json:"buying_liabilities,omitempty"`
+	SellingLiabilities string `json:"selling_liabilities,omitempty"`
+
+	// IsAuthorized is false if the issuer hasn't authorized (or has revoked) the trustline. It's
+	// always true for lumens, and for trustlines when horizon doesn't report it.
+	IsAuthorized bool `json:"is_authorized"`
+
+	// The ledger in which the balance last changed.
+	LastModifiedLedger uint32 `json:"last_modified_ledger,omitempty"`
 }
 
 // Signer represents a key that can sign for an account.
@@ -59,12 +74,17 @@ type Account struct {
 	Thresholds    Thresholds        `json:"thresholds"`
 	Data          map[string]string `json:"data"`
 	Sequence      string            `json:"seq"`
+	SubentryCount int32             `json:"subentry_count"`
+
+	// BaseReserve is used by SpendableBalance. It's not loaded with the account, see
+	// LoadBaseReserve.
+	BaseReserve Amount `json:"base_reserve,omitempty"`
 }
 
 // newAccount creates a new initialized account
 func newAccount() *Account {
 	account := &Account{}
-	account.NativeBalance = Balance{NativeAsset, "0", ""}
+	account.NativeBalance = Balance{Asset: NativeAsset, Amount: "0", IsAuthorized: true}
 	account.Signers = []Signer{
 		Signer{},
 	}
@@ -73,24 +93,79 @@ func newAccount() *Account {
 	return account
 }
 
+// horizonBalance is a balance returned by the horizon server, with the fields that the
+// horizon client doesn't decode.
+type horizonBalance struct {
+	horizon.Balance
+	IsAuthorized       *bool  `json:"is_authorized"`
+	LastModifiedLedger uint32 `json:"last_modified_ledger"`
+}
+
+// horizonAccount is an account returned by the horizon server, with the fields that the
+// horizon client doesn't decode.
+type horizonAccount struct {
+	horizon.Account
+	Balances []horizonBalance `json:"balances"`
+	Flags    struct {
+		horizon.AccountFlags
+		AuthImmutable bool `json:"auth_immutable"`
+	} `json:"flags"`
+}
+
+// loadHorizonAccount loads the account with address from horizon. Like the horizon client, it
+// returns a *horizon.Error for error responses.
+func loadHorizonAccount(client *horizon.Client, address string) (horizonAccount, error) {
+	var ha horizonAccount
+	resp, err := client.HTTP.Get(strings.TrimRight(client.URL, "/") + "/accounts/" + address)
+	if err != nil {
+		return ha, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		herr := &horizon.Error{Response: resp}
+		if err := decoder.Decode(&herr.Problem); err != nil {
+			return ha, errors.Wrap(err, "error decoding horizon.Problem")
+		}
+		return ha, herr
+	}
+
+	err = decoder.Decode(&ha)
+	return ha, err
+}
+
 // newAccountFromHorizon creates a new account from a Horizon JSON response.
-func newAccountFromHorizon(ha horizon.Account) *Account {
+func newAccountFromHorizon(ha horizonAccount) *Account {
 	account := newAccount()
 
 	account.Address = ha.HistoryAccount.AccountID
 	account.HomeDomain = ha.HomeDomain
 	account.Sequence = ha.Sequence
+	account.SubentryCount = ha.SubentryCount
 
 	for _, b := range ha.Balances {
 		if b.Asset.Type == string(NativeType) {
-			account.NativeBalance = Balance{NativeAsset, b.Balance, ""}
+			account.NativeBalance = Balance{
+				Asset:              NativeAsset,
+				Amount:             b.Balance.Balance,
+				BuyingLiabilities:  b.BuyingLiabilities,
+				SellingLiabilities: b.SellingLiabilities,
+				IsAuthorized:       true,
+				LastModifiedLedger: b.LastModifiedLedger,
+			}
 			continue
 		}
 
 		balance := Balance{
 			Asset:  NewAsset(b.Asset.Code, b.Asset.Issuer, AssetType(b.Asset.Type)),
-			Amount: b.Balance,
+			Amount: b.Balance.Balance,
 			Limit:  b.Limit,
+
+			BuyingLiabilities:  b.BuyingLiabilities,
+			SellingLiabilities: b.SellingLiabilities,
+			IsAuthorized:       b.IsAuthorized == nil || *b.IsAuthorized,
+			LastModifiedLedger: b.LastModifiedLedger,
 		}
 
 		account.Balances = append(account.Balances, balance)
@@ -113,6 +188,7 @@ func newAccountFromHorizon(ha horizon.Account) *Account {
 
 	account.Flags.AuthRequired = ha.Flags.AuthRequired
 	account.Flags.AuthRevocable = ha.Flags.AuthRevocable
+	account.Flags.AuthImmutable = ha.Flags.AuthImmutable
 
 	account.Data = map[string]string{}
 	for k, v := range ha.Data {
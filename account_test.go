@@ -1,6 +1,9 @@
 package microstellar
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestAccounts(t *testing.T) {
 	account := &Account{}
@@ -26,3 +29,42 @@ func TestAccounts(t *testing.T) {
 		t.Errorf("wrong native balance: want %v, got %v", "1", balance)
 	}
 }
+
+func TestLoadAccountFields(t *testing.T) {
+	server := newFakeHorizon(func(address string) (string, bool) {
+		return fmt.Sprintf(`"subentry_count": 2,
+			"flags": {"auth_required": true, "auth_revocable": false, "auth_immutable": true},
+			"balances": [
+				{"asset_type": "credit_alphanum4", "asset_code": "USD", "asset_issuer": "%s", "balance": "5.0000000",
+				 "limit": "100.0000000", "buying_liabilities": "1.0000000", "selling_liabilities": "2.0000000",
+				 "is_authorized": false, "last_modified_ledger": 42},
+				{"asset_type": "native", "balance": "10.0000000", "buying_liabilities": "0.0000000",
+				 "selling_liabilities": "3.0000000", "last_modified_ledger": 43}
+			]`, testAddress), address == testAddress
+	}, nil)
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	account, err := ms.LoadAccount(testAddress)
+	if err != nil {
+		t.Fatalf("LoadAccount failed: %v", err)
+	}
+
+	if !account.Flags.AuthRequired || !account.Flags.AuthImmutable || account.SubentryCount != 2 {
+		t.Errorf("bad flags: %+v", account.Flags)
+	}
+
+	usd := account.Balances[0]
+	if usd.IsAuthorized || usd.BuyingLiabilities != "1.0000000" || usd.SellingLiabilities != "2.0000000" || usd.LastModifiedLedger != 42 {
+		t.Errorf("bad USD balance: %+v", usd)
+	}
+
+	native := account.NativeBalance
+	if !native.IsAuthorized || native.Amount != "10.0000000" || native.SellingLiabilities != "3.0000000" || native.LastModifiedLedger != 43 {
+		t.Errorf("bad native balance: %+v", native)
+	}
+
+	if _, err := ms.LoadAccount(toAddress(testOtherSeed)); !isNotFound(err) {
+		t.Errorf("want not found error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AmountPrecision is the number of decimal places in a Stellar amount.
+const AmountPrecision = 7
+
+// Amount is a decimal-safe currency amount, stored as an int64 number of stroops (a stroop is 1e-7 units.)
+// Arithmetic on Amounts is exact, and fails with an error instead of overflowing. Amounts marshal
+// to and from JSON and text as decimal strings, e.g., "2.5000000".
+//
+//   a, err := microstellar.AmountFromString("2.5")
+//   total, err := a.Add(microstellar.MustAmount("0.25"))
+//   total.String() == "2.7500000"
+type Amount int64
+
+// AmountFromString parses a decimal amount string, e.g., "2.5", into an Amount.
+func AmountFromString(v string) (Amount, error) {
+	stroops, err := ParseAmount(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid amount: %s", v)
+	}
+
+	return Amount(stroops), nil
+}
+
+// MustAmount is the panicking version of AmountFromString, for use with constants.
+func MustAmount(v string) Amount {
+	a, err := AmountFromString(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
+
+// Stroops returns the amount as an integer number of stroops.
+func (a Amount) Stroops() int64 {
+	return int64(a)
+}
+
+// String returns the amount with all seven decimal places, e.g., "2.5000000".
+func (a Amount) String() string {
+	return ToAmountString(int64(a))
+}
+
+// StringFixed returns the amount rounded (half away from zero) to the given number of decimal
+// places. E.g., MustAmount("2.55").StringFixed(1) == "2.6".
+func (a Amount) StringFixed(decimals int) string {
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	if decimals >= AmountPrecision {
+		return a.String() + strings.Repeat("0", decimals-AmountPrecision)
+	}
+
+	r := new(big.Rat).SetFrac64(int64(a), 1)
+	r.Quo(r, big.NewRat(10000000, 1))
+	return r.FloatString(decimals)
+}
+
+// Add returns a + b, or an error if the result overflows.
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, errors.Errorf("amount overflow: %s + %s", a, b)
+	}
+
+	return sum, nil
+}
+
+// Sub returns a - b, or an error if the result overflows.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	diff := a - b
+	if (b > 0 && diff > a) || (b < 0 && diff < a) {
+		return 0, errors.Errorf("amount overflow: %s - %s", a, b)
+	}
+
+	return diff, nil
+}
+
+// Mul returns a multiplied by the rational n/d (e.g., the N and D of an offer's price), truncated
+// towards zero to the nearest stroop. Returns an error if d is zero or the result overflows.
+func (a Amount) Mul(n int64, d int64) (Amount, error) {
+	if d == 0 {
+		return 0, errors.Errorf("amount multiplied by %d/0", n)
+	}
+
+	return a.scale(n, d)
+}
+
+// Div returns a divided by the rational n/d, truncated towards zero to the nearest stroop. Returns
+// an error if n or d is zero, or the result overflows.
+func (a Amount) Div(n int64, d int64) (Amount, error) {
+	if n == 0 || d == 0 {
+		return 0, errors.Errorf("amount divided by %d/%d", n, d)
+	}
+
+	return a.scale(d, n)
+}
+
+// scale returns a * n / d with exact intermediate values.
+func (a Amount) scale(n int64, d int64) (Amount, error) {
+	result := new(big.Int).Mul(big.NewInt(int64(a)), big.NewInt(n))
+	result.Quo(result, big.NewInt(d))
+
+	if !result.IsInt64() {
+		return 0, errors.Errorf("amount overflow: %s * %d/%d", a, n, d)
+	}
+
+	return Amount(result.Int64()), nil
+}
+
+// Neg returns -a, or an error if a can't be negated.
+func (a Amount) Neg() (Amount, error) {
+	if a == math.MinInt64 {
+		return 0, errors.Errorf("amount overflow: -(%s)", a)
+	}
+
+	return -a, nil
+}
+
+// Cmp returns -1, 0, or 1 if a is less than, equal to, or greater than b.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// LessThan returns true if a < b.
+func (a Amount) LessThan(b Amount) bool {
+	return a < b
+}
+
+// GreaterThan returns true if a > b.
+func (a Amount) GreaterThan(b Amount) bool {
+	return a > b
+}
+
+// IsZero returns true if the amount is zero.
+func (a Amount) IsZero() bool {
+	return a == 0
+}
+
+// IsNegative returns true if the amount is less than zero.
+func (a Amount) IsNegative() bool {
+	return a < 0
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := AmountFromString(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, and accepts both strings ("2.5") and numbers (2.5).
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return a.UnmarshalText([]byte(text))
+	}
+
+	return a.UnmarshalText(data)
+}
+
+// AmountValue returns the balance's amount as an Amount.
+func (b Balance) AmountValue() (Amount, error) {
+	return AmountFromString(b.Amount)
+}
+
+// LimitValue returns the balance's trustline limit as an Amount. Native balances have no limit,
+// and return zero.
+func (b Balance) LimitValue() (Amount, error) {
+	if b.Limit == "" {
+		return 0, nil
+	}
+
+	return AmountFromString(b.Limit)
+}
+
+// AmountValue returns the order's amount as an Amount.
+func (ba BidAsk) AmountValue() (Amount, error) {
+	return AmountFromString(ba.Amount)
+}
+
+// SourceAmountValue returns the path's source amount as an Amount.
+func (p Path) SourceAmountValue() (Amount, error) {
+	return AmountFromString(p.SourceAmount)
+}
+
+// DestAmountValue returns the path's destination amount as an Amount.
+func (p Path) DestAmountValue() (Amount, error) {
+	return AmountFromString(p.DestAmount)
+}
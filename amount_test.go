@@ -0,0 +1,95 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestAmount(t *testing.T) {
+	a := MustAmount("2.5")
+	if a.Stroops() != 25000000 || a.String() != "2.5000000" {
+		t.Errorf("bad amount: %d %s", a.Stroops(), a)
+	}
+
+	if _, err := AmountFromString("1.00000001"); err == nil {
+		t.Errorf("amounts with more than 7 decimals should fail")
+	}
+
+	sum, err := a.Add(MustAmount("0.25"))
+	if err != nil || sum.String() != "2.7500000" {
+		t.Errorf("bad sum: %s, %v", sum, err)
+	}
+
+	diff, err := a.Sub(MustAmount("3"))
+	if err != nil || diff.String() != "-0.5000000" || !diff.IsNegative() {
+		t.Errorf("bad difference: %s, %v", diff, err)
+	}
+
+	if _, err := Amount(math.MaxInt64).Add(1); err == nil {
+		t.Errorf("Add should detect overflow")
+	}
+
+	if _, err := Amount(math.MinInt64).Sub(1); err == nil {
+		t.Errorf("Sub should detect overflow")
+	}
+
+	// 2.5 * 1/3, truncated to the stroop.
+	product, err := a.Mul(1, 3)
+	if err != nil || product.String() != "0.8333333" {
+		t.Errorf("bad product: %s, %v", product, err)
+	}
+
+	quotient, err := a.Div(1, 4)
+	if err != nil || quotient.String() != "10.0000000" {
+		t.Errorf("bad quotient: %s, %v", quotient, err)
+	}
+
+	if _, err := Amount(math.MaxInt64).Mul(2, 1); err == nil {
+		t.Errorf("Mul should detect overflow")
+	}
+
+	if _, err := a.Div(0, 1); err == nil {
+		t.Errorf("Div should fail on division by zero")
+	}
+
+	if a.Cmp(sum) != -1 || !a.LessThan(sum) || sum.GreaterThan(sum) || Amount(0).Cmp(0) != 0 {
+		t.Errorf("bad comparisons")
+	}
+
+	fixed := map[int]string{0: "3", 1: "2.8", 2: "2.75", 9: "2.750000000"}
+	for decimals, want := range fixed {
+		if got := sum.StringFixed(decimals); got != want {
+			t.Errorf("StringFixed(%d): want %s, got %s", decimals, want, got)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	var v struct {
+		Price  Amount `json:"price"`
+		Amount Amount `json:"amount"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"price": "1.5", "amount": 20}`), &v); err != nil {
+		t.Fatalf("can't unmarshal: %v", err)
+	}
+
+	data, _ := json.Marshal(v)
+	if string(data) != `{"price":"1.5000000","amount":"20.0000000"}` {
+		t.Errorf("bad JSON: %s", data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"price": "abc"}`), &v); err == nil {
+		t.Errorf("bad amounts should fail")
+	}
+
+	balance := Balance{Asset: NativeAsset, Amount: "10.5"}
+	if value, err := balance.AmountValue(); err != nil || value != MustAmount("10.5") {
+		t.Errorf("bad balance amount: %s, %v", value, err)
+	}
+
+	if limit, err := balance.LimitValue(); err != nil || !limit.IsZero() {
+		t.Errorf("bad balance limit: %s, %v", limit, err)
+	}
+}
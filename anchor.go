@@ -0,0 +1,472 @@
+package microstellar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+)
+
+// Anchor is a client for an anchor's SEP-6 (TRANSFER_SERVER) and SEP-24 (TRANSFER_SERVER_SEP0024)
+// deposit and withdrawal APIs. Use MicroStellar.LoadAnchor to create one.
+type Anchor struct {
+	ms *MicroStellar
+
+	Domain            string // Anchor's home domain
+	TransferServer    string // SEP-6 transfer server
+	InteractiveServer string // SEP-24 interactive transfer server
+	WebAuthEndpoint   string // SEP-10 web authentication endpoint
+	SigningKey        string // Key used to sign SEP-10 challenges
+
+	address string          // Authenticated account
+	token   string          // SEP-10 JWT
+	ctx     context.Context // Context for all requests, see WithContext
+}
+
+// AnchorAssetInfo describes the deposit or withdrawal parameters for a single asset. Fees and
+// limits are kept as the anchor sent them, to avoid float rounding. Use AmountFromString to get
+// at their values, including FeePercent (or big.Rat's SetString if it has more than 7 decimals.)
+type AnchorAssetInfo struct {
+	Enabled                bool                              `json:"enabled"`
+	AuthenticationRequired bool                              `json:"authentication_required"`
+	FeeFixed               json.Number                       `json:"fee_fixed"`
+	FeePercent             json.Number                       `json:"fee_percent"`
+	MinAmount              json.Number                       `json:"min_amount"`
+	MaxAmount              json.Number                       `json:"max_amount"`
+	Fields                 map[string]AnchorField            `json:"fields"`
+	Types                  map[string]map[string]AnchorField `json:"types"`
+}
+
+// AnchorField describes an extra field that the anchor accepts with a request.
+type AnchorField struct {
+	Description string   `json:"description"`
+	Optional    bool     `json:"optional"`
+	Choices     []string `json:"choices"`
+}
+
+// AnchorInfo is returned by Anchor.Info, and lists the assets and operations supported by the anchor.
+type AnchorInfo struct {
+	Deposit  map[string]AnchorAssetInfo `json:"deposit"`
+	Withdraw map[string]AnchorAssetInfo `json:"withdraw"`
+
+	Transactions struct {
+		Enabled                bool `json:"enabled"`
+		AuthenticationRequired bool `json:"authentication_required"`
+	} `json:"transactions"`
+}
+
+// DepositRequest specifies the parameters for Anchor.Deposit.
+type DepositRequest struct {
+	AssetCode    string            // Required: the code of the asset to deposit
+	Account      string            // Required: the stellar account to credit
+	MemoType     string            // Optional: "text", "id", or "hash"
+	Memo         string            // Optional: memo to attach to the deposit transaction
+	EmailAddress string            // Optional: email for status updates
+	Type         string            // Optional: deposit method (e.g., "SEPA")
+	Extra        map[string]string // Optional: any additional fields listed in AnchorInfo
+}
+
+// DepositInstructions are returned by the anchor with details on how to complete a deposit.
+type DepositInstructions struct {
+	ID         string      `json:"id"`
+	How        string      `json:"how"`
+	ETA        int64       `json:"eta"`
+	MinAmount  json.Number `json:"min_amount"`
+	MaxAmount  json.Number `json:"max_amount"`
+	FeeFixed   json.Number `json:"fee_fixed"`
+	FeePercent json.Number `json:"fee_percent"`
+	ExtraInfo  struct {
+		Message string `json:"message"`
+	} `json:"extra_info"`
+}
+
+// WithdrawRequest specifies the parameters for Anchor.Withdraw.
+type WithdrawRequest struct {
+	AssetCode string            // Required: the code of the asset to withdraw
+	Type      string            // Required: withdrawal method (e.g., "bank_account")
+	Dest      string            // Required: the off-chain destination (e.g., bank account number)
+	DestExtra string            // Optional: extra destination information (e.g., routing number)
+	Account   string            // Optional: the stellar account that will send the withdrawal
+	Extra     map[string]string // Optional: any additional fields listed in AnchorInfo
+}
+
+// WithdrawInstructions are returned by the anchor with the account and memo to send a
+// withdrawal payment to.
+type WithdrawInstructions struct {
+	ID         string      `json:"id"`
+	AccountID  string      `json:"account_id"`
+	MemoType   string      `json:"memo_type"`
+	Memo       string      `json:"memo"`
+	ETA        int64       `json:"eta"`
+	MinAmount  json.Number `json:"min_amount"`
+	MaxAmount  json.Number `json:"max_amount"`
+	FeeFixed   json.Number `json:"fee_fixed"`
+	FeePercent json.Number `json:"fee_percent"`
+	ExtraInfo  struct {
+		Message string `json:"message"`
+	} `json:"extra_info"`
+}
+
+// AnchorTransaction is the status of a deposit or withdrawal processed by the anchor.
+type AnchorTransaction struct {
+	ID                    string `json:"id"`
+	Kind                  string `json:"kind"`
+	Status                string `json:"status"`
+	StatusETA             int64  `json:"status_eta"`
+	MoreInfoURL           string `json:"more_info_url"`
+	AmountIn              string `json:"amount_in"`
+	AmountOut             string `json:"amount_out"`
+	AmountFee             string `json:"amount_fee"`
+	StartedAt             string `json:"started_at"`
+	CompletedAt           string `json:"completed_at"`
+	StellarTransactionID  string `json:"stellar_transaction_id"`
+	ExternalTransactionID string `json:"external_transaction_id"`
+	Message               string `json:"message"`
+	Refunded              bool   `json:"refunded"`
+	From                  string `json:"from"`
+	To                    string `json:"to"`
+	DepositMemo           string `json:"deposit_memo"`
+	DepositMemoType       string `json:"deposit_memo_type"`
+	WithdrawAnchorAccount string `json:"withdraw_anchor_account"`
+	WithdrawMemo          string `json:"withdraw_memo"`
+	WithdrawMemoType      string `json:"withdraw_memo_type"`
+}
+
+// InteractiveResponse is returned by the SEP-24 interactive deposit and withdrawal endpoints. Open
+// URL in a browser (or webview) so the user can complete the transaction with the anchor.
+type InteractiveResponse struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	ID   string `json:"id"`
+}
+
+// AnchorCustomerInfoError is returned when the anchor needs more information about the
+// customer before it can process a request.
+type AnchorCustomerInfoError struct {
+	Type        string   `json:"type"`
+	Fields      []string `json:"fields"`
+	URL         string   `json:"url"`
+	ID          string   `json:"id"`
+	Status      string   `json:"status"`
+	MoreInfoURL string   `json:"more_info_url"`
+}
+
+// Error implements the error interface.
+func (e *AnchorCustomerInfoError) Error() string {
+	switch e.Type {
+	case "non_interactive_customer_info_needed":
+		return fmt.Sprintf("anchor needs customer info: %s", strings.Join(e.Fields, ", "))
+	case "interactive_customer_info_needed":
+		return fmt.Sprintf("anchor needs customer info, visit: %s", e.URL)
+	}
+
+	return fmt.Sprintf("anchor customer info status: %s", e.Status)
+}
+
+// LoadAnchor reads the TRANSFER_SERVER, TRANSFER_SERVER_SEP0024, WEB_AUTH_ENDPOINT, and SIGNING_KEY
+// entries from domain's stellar.toml and returns an Anchor client for it.
+//
+//   anchor, err := ms.LoadAnchor("anchor.com")
+//   anchor.Authenticate("SCSMBQYTXKZYY7CLVT6NPPYWVDQYDOQ6BB3QND4OIXC7762JYJYZ3RMK")
+//   instructions, err := anchor.Deposit(microstellar.DepositRequest{AssetCode: "USD", Account: "GAIUIQ..."})
+//
+// The context set with Options.WithContext is used for all subsequent requests to the anchor.
+func (ms *MicroStellar) LoadAnchor(domain string, options ...*Options) (*Anchor, error) {
+	doc, err := ms.LoadStellarTOML(domain, options...)
+	if err != nil {
+		return nil, ms.wrapf(err, "can't load anchor")
+	}
+
+	if doc.TransferServer == "" && doc.TransferServerSEP24 == "" {
+		return nil, ms.errorf("can't load anchor: %s has no transfer server", domain)
+	}
+
+	return &Anchor{
+		ms:                ms,
+		Domain:            domain,
+		TransferServer:    strings.TrimRight(doc.TransferServer, "/"),
+		InteractiveServer: strings.TrimRight(doc.TransferServerSEP24, "/"),
+		WebAuthEndpoint:   doc.WebAuthEndpoint,
+		SigningKey:        doc.SigningKey,
+		ctx:               mergeOptions(options).ctx,
+	}, ms.success()
+}
+
+// WithContext returns a copy of the anchor client that uses ctx for all requests. Use this to
+// cancel anchor requests, e.g., when an incoming HTTP request is cancelled.
+//
+//   instructions, err := anchor.WithContext(r.Context()).Deposit(req)
+func (anchor *Anchor) WithContext(ctx context.Context) *Anchor {
+	copy := *anchor
+	copy.ctx = ctx
+	return &copy
+}
+
+// Authenticate performs SEP-10 web authentication with seed, and uses the returned token for all
+// subsequent requests to the anchor.
+func (anchor *Anchor) Authenticate(seed string) error {
+	if anchor.WebAuthEndpoint == "" {
+		return errors.Errorf("anchor %s does not support web authentication", anchor.Domain)
+	}
+
+	opts := Opts().WithContext(anchor.ctx)
+	if anchor.SigningKey != "" {
+		opts = opts.WithServerKey(anchor.SigningKey)
+	}
+
+	token, err := anchor.ms.SEP10Authenticate(anchor.WebAuthEndpoint, seed, opts)
+	if err != nil {
+		return errors.Wrap(err, "anchor authentication failed")
+	}
+
+	kp, _ := keypair.Parse(seed)
+	anchor.address = kp.Address()
+	anchor.token = token
+	return nil
+}
+
+// Info returns the assets and operations supported by the anchor.
+func (anchor *Anchor) Info() (*AnchorInfo, error) {
+	var info AnchorInfo
+	if err := anchor.get(anchor.TransferServer, "/info", url.Values{}, &info); err != nil {
+		return nil, errors.Wrap(err, "can't load anchor info")
+	}
+
+	return &info, nil
+}
+
+// Deposit asks the anchor for instructions on depositing an off-chain asset to a stellar account. If
+// the anchor needs more information about the customer, errors.Cause(err) is an
+// *AnchorCustomerInfoError.
+func (anchor *Anchor) Deposit(req DepositRequest) (*DepositInstructions, error) {
+	query := url.Values{}
+	query.Add("asset_code", req.AssetCode)
+	query.Add("account", anchor.accountOr(req.Account))
+	addOptional(query, "memo_type", req.MemoType)
+	addOptional(query, "memo", req.Memo)
+	addOptional(query, "email_address", req.EmailAddress)
+	addOptional(query, "type", req.Type)
+	for k, v := range req.Extra {
+		query.Add(k, v)
+	}
+
+	var instructions DepositInstructions
+	if err := anchor.get(anchor.TransferServer, "/deposit", query, &instructions); err != nil {
+		return nil, errors.Wrap(err, "deposit failed")
+	}
+
+	return &instructions, nil
+}
+
+// Withdraw asks the anchor for instructions on withdrawing a stellar asset to an off-chain destination. Send
+// the payment to the returned AccountID with the returned memo, or use WithdrawAndPay to do both. If
+// the anchor needs more information about the customer, errors.Cause(err) is an
+// *AnchorCustomerInfoError.
+func (anchor *Anchor) Withdraw(req WithdrawRequest) (*WithdrawInstructions, error) {
+	query := url.Values{}
+	query.Add("asset_code", req.AssetCode)
+	query.Add("type", req.Type)
+	query.Add("dest", req.Dest)
+	addOptional(query, "dest_extra", req.DestExtra)
+	addOptional(query, "account", anchor.accountOr(req.Account))
+	for k, v := range req.Extra {
+		query.Add(k, v)
+	}
+
+	var instructions WithdrawInstructions
+	if err := anchor.get(anchor.TransferServer, "/withdraw", query, &instructions); err != nil {
+		return nil, errors.Wrap(err, "withdraw failed")
+	}
+
+	if err := ValidAddress(instructions.AccountID); err != nil {
+		return nil, errors.Wrapf(err, "anchor returned bad withdrawal account")
+	}
+
+	return &instructions, nil
+}
+
+// WithdrawAndPay requests withdrawal instructions from the anchor, and then pays amount of asset from
+// sourceSeed to the anchor's account with the anchor-supplied memo. Any memo set in options is
+// replaced by the anchor's memo.
+func (anchor *Anchor) WithdrawAndPay(sourceSeed string, req WithdrawRequest, amount string, asset *Asset, options ...*Options) (*WithdrawInstructions, error) {
+	if req.AssetCode == "" {
+		req.AssetCode = asset.Code
+	}
+
+	instructions, err := anchor.Withdraw(req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := *mergeOptions(options)
+	if err := opts.setMemo(instructions.MemoType, instructions.Memo); err != nil {
+		return instructions, errors.Wrap(err, "anchor returned bad memo")
+	}
+
+	if err := anchor.ms.Pay(sourceSeed, instructions.AccountID, amount, asset, &opts); err != nil {
+		return instructions, errors.Wrap(err, "withdrawal payment failed")
+	}
+
+	return instructions, nil
+}
+
+// DepositInteractive starts a SEP-24 interactive deposit of assetCode. Open the returned URL
+// so the user can complete the deposit with the anchor.
+func (anchor *Anchor) DepositInteractive(assetCode string, account string) (*InteractiveResponse, error) {
+	return anchor.interactive("/transactions/deposit/interactive", assetCode, account)
+}
+
+// WithdrawInteractive starts a SEP-24 interactive withdrawal of assetCode. Open the returned URL
+// so the user can complete the withdrawal with the anchor.
+func (anchor *Anchor) WithdrawInteractive(assetCode string, account string) (*InteractiveResponse, error) {
+	return anchor.interactive("/transactions/withdraw/interactive", assetCode, account)
+}
+
+// Transaction returns the status of the deposit or withdrawal with the given anchor transaction ID.
+func (anchor *Anchor) Transaction(id string) (*AnchorTransaction, error) {
+	query := url.Values{}
+	query.Add("id", id)
+
+	var resp struct {
+		Transaction AnchorTransaction `json:"transaction"`
+	}
+
+	if err := anchor.get(anchor.statusServer(), "/transaction", query, &resp); err != nil {
+		return nil, errors.Wrap(err, "can't load anchor transaction")
+	}
+
+	return &resp.Transaction, nil
+}
+
+// Transactions returns the deposits and withdrawals of assetCode made by the authenticated account. Use
+// Opts().WithLimit and Opts().WithCursor (set to a transaction ID) to page through the results.
+func (anchor *Anchor) Transactions(assetCode string, options ...*Options) ([]AnchorTransaction, error) {
+	opts := mergeOptions(options)
+
+	query := url.Values{}
+	query.Add("asset_code", assetCode)
+	addOptional(query, "account", anchor.address)
+	if opts.hasLimit {
+		query.Add("limit", fmt.Sprintf("%d", opts.limit))
+	}
+	if opts.hasCursor {
+		query.Add("paging_id", opts.cursor)
+	}
+
+	var resp struct {
+		Transactions []AnchorTransaction `json:"transactions"`
+	}
+
+	if err := anchor.get(anchor.statusServer(), "/transactions", query, &resp); err != nil {
+		return nil, errors.Wrap(err, "can't load anchor transactions")
+	}
+
+	return resp.Transactions, nil
+}
+
+// interactive starts a SEP-24 interactive flow at path.
+func (anchor *Anchor) interactive(path string, assetCode string, account string) (*InteractiveResponse, error) {
+	if anchor.InteractiveServer == "" {
+		return nil, errors.Errorf("anchor %s does not support interactive transfers", anchor.Domain)
+	}
+
+	form := url.Values{}
+	form.Add("asset_code", assetCode)
+	addOptional(form, "account", anchor.accountOr(account))
+
+	req, err := http.NewRequest("POST", anchor.InteractiveServer+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "bad request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp InteractiveResponse
+	if err := anchor.do(req, &resp); err != nil {
+		return nil, errors.Wrap(err, "interactive request failed")
+	}
+
+	return &resp, nil
+}
+
+// statusServer returns the server used for transaction status requests.
+func (anchor *Anchor) statusServer() string {
+	if anchor.TransferServer == "" {
+		return anchor.InteractiveServer
+	}
+
+	return anchor.TransferServer
+}
+
+// accountOr returns account if set, otherwise the authenticated account.
+func (anchor *Anchor) accountOr(account string) string {
+	if account == "" {
+		return anchor.address
+	}
+
+	return account
+}
+
+// get sends a GET request to path on server, and decodes the response into v.
+func (anchor *Anchor) get(server string, path string, query url.Values, v interface{}) error {
+	if server == "" {
+		return errors.Errorf("anchor %s has no transfer server", anchor.Domain)
+	}
+
+	req, err := http.NewRequest("GET", server+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return errors.Wrap(err, "bad request")
+	}
+
+	return anchor.do(req, v)
+}
+
+// do sends req with the authentication token (if any), and decodes the response into v.
+func (anchor *Anchor) do(req *http.Request, v interface{}) error {
+	if anchor.token != "" {
+		req.Header.Set("Authorization", "Bearer "+anchor.token)
+	}
+
+	debugf("Anchor", "%s %s", req.Method, req.URL.String())
+	client := anchor.ms.httpClient([]*Options{Opts().WithContext(anchor.ctx)})
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "could not read response")
+	}
+
+	debugf("Anchor", "got status %d, body: %s", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusForbidden {
+		var infoErr AnchorCustomerInfoError
+		if json.Unmarshal(body, &infoErr) == nil && infoErr.Type != "" {
+			return &infoErr
+		}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &errResp)
+		return errors.Errorf("anchor returned status %d: %s", resp.StatusCode, errResp.Error)
+	}
+
+	return errors.Wrap(json.Unmarshal(body, v), "could not unmarshal response")
+}
+
+// addOptional adds key to query if value is not empty.
+func addOptional(query url.Values, key string, value string) {
+	if value != "" {
+		query.Add(key, value)
+	}
+}
@@ -0,0 +1,78 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func newTestAnchor(ms *MicroStellar) (*Anchor, *httptest.Server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"deposit": {"USD": {"enabled": true, "fee_fixed": 5, "fee_percent": "0.1", "min_amount": 0.1}}, "withdraw": {"USD": {"enabled": true}}}`)
+	})
+	mux.HandleFunc("/deposit", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"type": "non_interactive_customer_info_needed", "fields": ["first_name", "last_name"]}`)
+	})
+	mux.HandleFunc("/withdraw", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dest") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "missing dest"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "42", "account_id": "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ", "memo_type": "id", "memo": "1234"}`)
+	})
+	mux.HandleFunc("/transaction", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"transaction": {"id": "%s", "kind": "withdrawal", "status": "completed"}}`, r.URL.Query().Get("id"))
+	})
+
+	server := httptest.NewServer(mux)
+	return &Anchor{ms: ms, Domain: "anchor.test", TransferServer: server.URL}, server
+}
+
+func TestAnchor(t *testing.T) {
+	anchor, server := newTestAnchor(New("fake"))
+	defer server.Close()
+
+	info, err := anchor.Info()
+	if err != nil {
+		t.Fatalf("Info: %v", err)
+	}
+
+	if !info.Deposit["USD"].Enabled || info.Deposit["USD"].FeeFixed != "5" || info.Deposit["USD"].FeePercent != "0.1" || info.Deposit["USD"].MinAmount != "0.1" {
+		t.Errorf("wrong deposit info: %+v", info.Deposit)
+	}
+
+	_, err = anchor.Deposit(DepositRequest{AssetCode: "USD", Account: "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"})
+	if infoErr, ok := errors.Cause(err).(*AnchorCustomerInfoError); !ok || len(infoErr.Fields) != 2 {
+		t.Errorf("Deposit should return AnchorCustomerInfoError: got %v", err)
+	}
+
+	if _, err = anchor.Withdraw(WithdrawRequest{AssetCode: "USD", Type: "bank_account"}); err == nil {
+		t.Errorf("Withdraw without dest should fail")
+	}
+
+	USD := NewAsset("USD", "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ", Credit4Type)
+	instructions, err := anchor.WithdrawAndPay("SCSMBQYTXKZYY7CLVT6NPPYWVDQYDOQ6BB3QND4OIXC7762JYJYZ3RMK",
+		WithdrawRequest{Type: "bank_account", Dest: "1234567"}, "10", USD)
+	if err != nil {
+		t.Fatalf("WithdrawAndPay: %v", err)
+	}
+
+	if instructions.Memo != "1234" || instructions.MemoType != "id" {
+		t.Errorf("wrong withdraw instructions: %+v", instructions)
+	}
+
+	tx, err := anchor.Transaction("42")
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+
+	if tx.ID != "42" || tx.Status != "completed" {
+		t.Errorf("wrong transaction: %+v", tx)
+	}
+}
@@ -1,6 +1,10 @@
 package microstellar
 
 import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/stellar/go/build"
 )
@@ -39,6 +43,92 @@ func NewAsset(code string, issuer string, assetType AssetType) *Asset {
 	return &Asset{code, issuer, assetType}
 }
 
+// NewCreditAsset creates a new credit asset with the given code and issuer, with the asset type
+// (Credit4Type or Credit12Type) inferred from the code's length.
+//
+//   USD := microstellar.NewCreditAsset("USD", "issuer_address")
+func NewCreditAsset(code string, issuer string) *Asset {
+	if len(code) > 4 {
+		return NewAsset(code, issuer, Credit12Type)
+	}
+
+	return NewAsset(code, issuer, Credit4Type)
+}
+
+// assetCodeRE matches valid asset codes.
+var assetCodeRE = regexp.MustCompile("^[a-zA-Z0-9]{1,12}$")
+
+// ParseAsset parses an asset in the canonical form returned by Asset.String, i.e., "native" for
+// lumens, or "CODE:ISSUER" for credit assets. The asset type is inferred from the code's length.
+//
+//   USD, err := microstellar.ParseAsset("USD:GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ")
+func ParseAsset(s string) (*Asset, error) {
+	if s == string(NativeType) {
+		native := *NativeAsset
+		return &native, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid asset: %q: want native or CODE:ISSUER", s)
+	}
+
+	if !assetCodeRE.MatchString(parts[0]) {
+		return nil, errors.Errorf("invalid asset: %q: bad code", s)
+	}
+
+	if err := ValidAddress(parts[1]); err != nil {
+		return nil, errors.Wrapf(err, "invalid asset: %q", s)
+	}
+
+	return NewCreditAsset(parts[0], parts[1]), nil
+}
+
+// String returns the asset in canonical form: "native" for lumens, or "CODE:ISSUER".
+func (asset Asset) String() string {
+	if asset.IsNative() {
+		return string(NativeType)
+	}
+
+	return asset.Code + ":" + asset.Issuer
+}
+
+// MarshalText implements encoding.TextMarshaler, using the canonical form. This lets assets be
+// used as JSON map keys, flags, and config values.
+func (asset Asset) MarshalText() ([]byte, error) {
+	return []byte(asset.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. See ParseAsset.
+func (asset *Asset) UnmarshalText(text []byte) error {
+	parsed, err := ParseAsset(string(text))
+	if err != nil {
+		return err
+	}
+
+	*asset = *parsed
+	return nil
+}
+
+// jsonAsset has Asset's fields, but not its methods, to encode assets as JSON objects.
+type jsonAsset Asset
+
+// MarshalJSON implements json.Marshaler. Assets are encoded as objects, e.g., {"code": "USD",
+// "issuer": "...", "type": "credit_alphanum4"}, except as map keys.
+func (asset Asset) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonAsset(asset))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, and accepts both objects and canonical strings.
+func (asset *Asset) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return asset.UnmarshalText([]byte(text))
+	}
+
+	return json.Unmarshal(data, (*jsonAsset)(asset))
+}
+
 // Equals returns true if "this" and "that" represent the same asset class.
 func (this Asset) Equals(that Asset) bool {
 	// For native assets, don't compare code or issuer
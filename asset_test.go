@@ -1,6 +1,10 @@
 package microstellar
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func TestAssetTypes(t *testing.T) {
 	asset := NewAsset("QBIT", "ISSUER", Credit4Type)
@@ -37,3 +41,73 @@ func TestAssetTypes(t *testing.T) {
 		t.Errorf("asset.Validate() error: %v", err)
 	}
 }
+
+func TestParseAsset(t *testing.T) {
+	issuer := "GDUAQWGIKQFET4BEUEA3ZUJ6WOBT3KCMZ7UG35UL5R37C5RIFQEAEZJ3"
+
+	tests := []struct {
+		s        string
+		wantType AssetType
+		wantErr  bool
+	}{
+		{"native", NativeType, false},
+		{"USD:" + issuer, Credit4Type, false},
+		{"MOOLAH:" + issuer, Credit12Type, false},
+		{"USD", "", true},
+		{"USD:ISSUER", "", true},
+		{"TOOLONGASSETCODE:" + issuer, "", true},
+		{"U$D:" + issuer, "", true},
+		{"USD:" + issuer + ":extra", "", true},
+	}
+
+	for _, test := range tests {
+		asset, err := ParseAsset(test.s)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseAsset(%q) should fail", test.s)
+			}
+			continue
+		}
+
+		if err != nil || asset.Type != test.wantType || asset.String() != test.s {
+			t.Errorf("ParseAsset(%q): got %+v, %v", test.s, asset, err)
+		}
+	}
+
+	if NewCreditAsset("MOOLAH", issuer).Type != Credit12Type || NewCreditAsset("USD", issuer).Type != Credit4Type {
+		t.Errorf("NewCreditAsset should infer the asset type")
+	}
+}
+
+func TestAssetMarshalling(t *testing.T) {
+	USD := NewCreditAsset("USD", "GDUAQWGIKQFET4BEUEA3ZUJ6WOBT3KCMZ7UG35UL5R37C5RIFQEAEZJ3")
+
+	// Assets are objects in JSON, but strings as map keys.
+	data, err := json.Marshal(map[Asset]*Asset{*USD: USD, *NativeAsset: NativeAsset})
+	if err != nil {
+		t.Fatalf("can't marshal assets: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"native":{"code":"XLM","issuer":"","type":"native"}`) ||
+		!strings.Contains(string(data), `"USD:`+USD.Issuer+`":{"code":"USD"`) {
+		t.Errorf("bad JSON: %s", data)
+	}
+
+	var decoded map[Asset]*Asset
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 2 || !decoded[*USD].Equals(*USD) {
+		t.Errorf("assets don't round-trip: %+v, %v", decoded, err)
+	}
+
+	var config struct {
+		Asset *Asset `json:"asset"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"asset": "USD:`+USD.Issuer+`"}`), &config); err != nil || !config.Asset.Equals(*USD) {
+		t.Errorf("can't decode canonical asset string: %+v, %v", config.Asset, err)
+	}
+
+	var text Asset
+	if err := text.UnmarshalText([]byte("bad")); err == nil {
+		t.Errorf("bad assets should fail")
+	}
+}
@@ -0,0 +1,573 @@
+package microstellar
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxOpsPerTx is the maximum number of operations in a single transaction.
+const MaxOpsPerTx = 100
+
+// PaymentInstruction is a single payment in a batch passed to BatchPay.
+type PaymentInstruction struct {
+	// ID identifies the payment in the batch journal, so it must be unique and stable across
+	// runs. Defaults to the payment's index in the batch.
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Asset   *Asset `json:"asset"` // defaults to NativeAsset
+}
+
+// PaymentStatus is the outcome of a PaymentInstruction in a BatchReport.
+type PaymentStatus string
+
+// Payment statuses.
+const (
+	PaymentPaid    PaymentStatus = "paid"    // paid in this run
+	PaymentSkipped PaymentStatus = "skipped" // paid in an earlier run, according to the journal
+	PaymentInvalid PaymentStatus = "invalid" // failed validation, and was not submitted
+	PaymentFailed  PaymentStatus = "failed"  // the transaction carrying the payment was rejected
+	PaymentUnknown PaymentStatus = "unknown" // the transaction was submitted, but may or may not succeed
+)
+
+// PaymentResult is the outcome of a single PaymentInstruction.
+type PaymentResult struct {
+	Instruction PaymentInstruction
+	Status      PaymentStatus
+	TxHash      string // hash of the transaction that paid the instruction
+	Err         error  // why the payment is invalid or failed
+}
+
+// BatchReport is returned by BatchPay, with one result per instruction, in order.
+type BatchReport struct {
+	Results []PaymentResult
+}
+
+// Count returns the number of payments with status.
+func (report *BatchReport) Count(status PaymentStatus) int {
+	count := 0
+	for _, result := range report.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// String returns a one-line summary of the report.
+func (report *BatchReport) String() string {
+	return fmt.Sprintf("%d paid, %d skipped, %d invalid, %d failed, %d unknown",
+		report.Count(PaymentPaid), report.Count(PaymentSkipped), report.Count(PaymentInvalid), report.Count(PaymentFailed),
+		report.Count(PaymentUnknown))
+}
+
+// Journal entry statuses. Paid entries have no status.
+const (
+	journalPending = "pending" // the transaction was about to be submitted
+	journalFailed  = "failed"  // the transaction was rejected, so the payment can be retried
+)
+
+// journalEntry is a line in a batch journal. Instructions are journaled as pending, with the hash
+// and sequence number of the transaction that carries them, before it's submitted, and again
+// once the transaction succeeds or is rejected. Later lines override earlier ones.
+type journalEntry struct {
+	ID       string `json:"id"`
+	TxHash   string `json:"tx_hash"`
+	Sequence int64  `json:"seq,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// readJournal returns the latest entries in the journal at path, by ID. A missing journal is
+// empty.
+func readJournal(path string) (map[string]journalEntry, error) {
+	entries := map[string]journalEntry{}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash can leave a partial last line.
+			debugf("readJournal", "skipping bad journal line: %s", scanner.Text())
+			continue
+		}
+
+		entries[entry.ID] = entry
+	}
+
+	return entries, scanner.Err()
+}
+
+// BatchPay pays all the instructions from sourceSeed, packing them into multi-op transactions of
+// up to MaxOpsPerTx payments. Instructions are validated before anything is submitted: addresses,
+// amounts, and assets must be valid, destinations must exist, trust the asset, and (unless the
+// batch has a memo) not require memos. Invalid instructions are skipped.
+//
+// Options apply to every transaction in the batch (e.g., memos, fees, and signers.) Set
+// Options.WithJournal to record payments in a file, so that re-running an interrupted batch with
+// the same journal skips the payments already made.
+//
+//   instructions, err := microstellar.LoadPaymentInstructions("payouts.csv")
+//   report, err := ms.BatchPay("source_seed", instructions, microstellar.Opts().WithJournal("payouts.journal"))
+//   for _, result := range report.Results {
+//       log.Printf("%s: %s %v", result.Instruction.Address, result.Status, result.Err)
+//   }
+//
+// BatchPay returns an error if any payment is invalid or failed, along with the full report. A
+// transaction that Horizon rejects fails all the payments in it, so they can be retried in another
+// run. If a submission's outcome is unknown (e.g., Horizon timed out, or the connection dropped),
+// its payments are PaymentUnknown instead: the transaction may still succeed, so don't pay them
+// again by other means. Payments are journaled as pending before they're submitted, and the next
+// run looks up their transaction, and only retries them if it failed or can no longer succeed.
+func (ms *MicroStellar) BatchPay(sourceSeed string, instructions []PaymentInstruction, options ...*Options) (*BatchReport, error) {
+	if !ValidAddressOrSeed(sourceSeed) {
+		return nil, ms.errorf("invalid source address or seed: %s", sourceSeed)
+	}
+
+	opts := mergeOptions(options)
+	if opts.isMultiOp {
+		return nil, ms.errorf("can't run a batch inside a multi-op transaction")
+	}
+
+	journaled := map[string]journalEntry{}
+	var journal *os.File
+	if opts.journal != "" {
+		var err error
+		if journaled, err = readJournal(opts.journal); err != nil {
+			return nil, ms.wrapf(err, "can't read journal")
+		}
+
+		if journal, err = os.OpenFile(opts.journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return nil, ms.wrapf(err, "can't open journal")
+		}
+		defer journal.Close()
+	}
+
+	report := &BatchReport{Results: make([]PaymentResult, len(instructions))}
+	pending := []int{}
+	resolved := []int{}
+	checked := map[string]pendingCheck{}
+	for i, instruction := range instructions {
+		if instruction.ID == "" {
+			instruction.ID = strconv.Itoa(i)
+		}
+
+		if instruction.Asset == nil {
+			instruction.Asset = NativeAsset
+		}
+
+		result := &report.Results[i]
+		result.Instruction = instruction
+
+		entry, ok := journaled[instruction.ID]
+		if !ok || entry.Status == journalFailed {
+			pending = append(pending, i)
+			continue
+		}
+
+		if entry.Status == journalPending {
+			// An earlier run lost track of the transaction, so find out what happened to it.
+			check, ok := checked[entry.TxHash]
+			if !ok {
+				check.paid, check.err = ms.checkPending(toAddress(sourceSeed), entry, opts)
+				checked[entry.TxHash] = check
+			}
+
+			if check.err != nil {
+				result.Status = PaymentUnknown
+				result.TxHash = entry.TxHash
+				result.Err = check.err
+				continue
+			}
+
+			if !check.paid {
+				pending = append(pending, i)
+				continue
+			}
+
+			resolved = append(resolved, i)
+		}
+
+		result.Status = PaymentSkipped
+		result.TxHash = entry.TxHash
+	}
+
+	if len(resolved) > 0 {
+		if err := writeJournal(journal, journalEntries(report, resolved, "", 0)); err != nil {
+			return report, ms.wrapf(err, "can't journal resolved payments")
+		}
+	}
+
+	pending = ms.validateBatch(report, pending, opts)
+
+	for start := 0; start < len(pending); start += MaxOpsPerTx {
+		end := start + MaxOpsPerTx
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		chunk := pending[start:end]
+		hash, status, err := ms.payChunk(sourceSeed, report, chunk, opts, journal)
+		for _, i := range chunk {
+			result := &report.Results[i]
+			result.Status = status
+			result.TxHash = hash
+			result.Err = err
+		}
+
+		if journal == nil {
+			continue
+		}
+
+		switch status {
+		case PaymentPaid:
+			if err := writeJournal(journal, journalEntries(report, chunk, "", 0)); err != nil {
+				return report, ms.wrapf(err, "payments in transaction %s were made, but can't be journaled", hash)
+			}
+		case PaymentFailed:
+			if err := writeJournal(journal, journalEntries(report, chunk, journalFailed, 0)); err != nil {
+				return report, ms.wrapf(err, "transaction %s was rejected, but can't be journaled", hash)
+			}
+		}
+	}
+
+	failed := report.Count(PaymentInvalid) + report.Count(PaymentFailed) + report.Count(PaymentUnknown)
+	if failed > 0 {
+		return report, ms.errorf("%d of %d payments failed", failed, len(instructions))
+	}
+
+	return report, ms.success()
+}
+
+// validateBatch checks the pending instructions, marks the invalid ones in report, and returns
+// the valid ones.
+func (ms *MicroStellar) validateBatch(report *BatchReport, pending []int, opts *Options) []int {
+	seen := map[string]bool{}
+	accounts := map[string]*Account{}
+	valid := []int{}
+
+	for _, i := range pending {
+		result := &report.Results[i]
+		if err := ms.validateInstruction(result.Instruction, opts, seen, accounts); err != nil {
+			result.Status = PaymentInvalid
+			result.Err = err
+			continue
+		}
+
+		valid = append(valid, i)
+	}
+
+	return valid
+}
+
+// validateInstruction returns an error if instruction can't be paid. Destination accounts are
+// loaded into accounts, so that each is loaded once per batch.
+func (ms *MicroStellar) validateInstruction(instruction PaymentInstruction, opts *Options, seen map[string]bool, accounts map[string]*Account) error {
+	if seen[instruction.ID] {
+		return errors.Errorf("duplicate payment ID: %s", instruction.ID)
+	}
+	seen[instruction.ID] = true
+
+	if err := ValidAddress(instruction.Address); err != nil {
+		return errors.Wrapf(err, "invalid address: %s", instruction.Address)
+	}
+
+	amount, err := ParseAmount(instruction.Amount)
+	if err != nil || amount <= 0 {
+		return errors.Errorf("invalid amount: %s", instruction.Amount)
+	}
+
+	asset := instruction.Asset
+	if err := asset.Validate(); err != nil {
+		return errors.Wrap(err, "invalid asset")
+	}
+
+	if ms.fake {
+		return nil
+	}
+
+	account, ok := accounts[instruction.Address]
+	if !ok {
+		if account, err = ms.LoadAccount(instruction.Address, opts); err != nil {
+			if isNotFound(err) {
+				return errors.Errorf("destination account does not exist: %s", instruction.Address)
+			}
+
+			return errors.Wrapf(err, "can't load destination account: %s", instruction.Address)
+		}
+
+		accounts[instruction.Address] = account
+	}
+
+	if !asset.IsNative() && asset.Issuer != instruction.Address && account.GetBalance(asset) == "" {
+		return errors.Errorf("destination account does not trust %s issued by %s", asset.Code, asset.Issuer)
+	}
+
+	if opts.memoType == MemoNone && account.RequiresMemo() && !opts.skipMemoRequiredCheck {
+		return &MemoRequiredError{Address: instruction.Address}
+	}
+
+	return nil
+}
+
+// payChunk submits the payments for the instructions at indexes in a single transaction, and
+// returns its hash and the payments' status. If journal is set, the payments are journaled as
+// pending before the transaction is submitted.
+func (ms *MicroStellar) payChunk(sourceSeed string, report *BatchReport, indexes []int, opts *Options, journal *os.File) (string, PaymentStatus, error) {
+	// Start marks the options as multi-op, so give it a copy.
+	chunkOpts := *opts
+	ms.Start(sourceSeed, &chunkOpts)
+
+	for _, i := range indexes {
+		instruction := report.Results[i].Instruction
+		if err := ms.Pay(sourceSeed, instruction.Address, instruction.Amount, instruction.Asset); err != nil {
+			ms.tx = nil
+			return "", PaymentFailed, errors.Wrapf(err, "can't add payment %s", instruction.ID)
+		}
+	}
+
+	// Sign and submit separately (unlike ms.Submit), so the hash can be journaled in between.
+	tx := ms.getTx()
+	ms.tx = nil
+	ms.lastTx = tx
+
+	if err := tx.Sign(); err != nil {
+		return "", PaymentFailed, err
+	}
+
+	hash := ""
+	if built := tx.builtTx(); built != nil {
+		var err error
+		if hash, err = tx.builder.HashHex(); err != nil {
+			return "", PaymentFailed, errors.Wrap(err, "can't hash transaction")
+		}
+
+		for _, i := range indexes {
+			report.Results[i].TxHash = hash
+		}
+
+		if journal != nil {
+			if err := writeJournal(journal, journalEntries(report, indexes, journalPending, int64(built.SeqNum))); err != nil {
+				return "", PaymentFailed, errors.Wrap(err, "can't journal pending payments")
+			}
+		}
+	}
+
+	err := tx.Submit()
+	ms.invalidateTx(tx.builtTx())
+
+	if err != nil {
+		if isOutcomeUnknown(err) {
+			return hash, PaymentUnknown, errors.Wrapf(err, "outcome of transaction %s is unknown", hash)
+		}
+
+		return hash, PaymentFailed, err
+	}
+
+	return tx.Response().Hash, PaymentPaid, nil
+}
+
+// pendingCheck is the result of checkPending for a transaction.
+type pendingCheck struct {
+	paid bool
+	err  error
+}
+
+// checkPending looks up the transaction of a pending journal entry, and returns true if it
+// succeeded. It returns false if the transaction failed, or if it's not in the ledger and can't
+// get there anymore because the source account's sequence number has moved past it. Otherwise,
+// the transaction's outcome is still unknown, and it returns an error.
+func (ms *MicroStellar) checkPending(sourceAddress string, entry journalEntry, opts *Options) (bool, error) {
+	client := ms.queryTx([]*Options{opts}).GetClient()
+
+	// Load the sequence number before looking up the transaction: if the transaction lands in
+	// between, the lookup finds it. In the other order, the lookup could miss it, and the moved
+	// sequence number would make it look lost. Load the account directly, since a cached account
+	// can have a stale sequence number.
+	account, err := loadHorizonAccount(client, sourceAddress)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't load source account of pending transaction %s", entry.TxHash)
+	}
+
+	sequence, err := strconv.ParseInt(account.Sequence, 10, 64)
+	if err != nil {
+		return false, errors.Wrapf(err, "bad sequence number for %s", sourceAddress)
+	}
+
+	endpoint := strings.TrimRight(client.URL, "/") + "/transactions/" + entry.TxHash
+	debugf("checkPending", "looking up pending transaction: %s", endpoint)
+	resp, err := client.HTTP.Get(endpoint)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't look up pending transaction %s", entry.TxHash)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var found struct {
+			Successful *bool `json:"successful"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&found); err != nil {
+			return false, errors.Wrapf(err, "can't decode pending transaction %s", entry.TxHash)
+		}
+
+		// Older versions of horizon only serve successful transactions.
+		return found.Successful == nil || *found.Successful, nil
+	case http.StatusNotFound:
+	default:
+		return false, errors.Errorf("can't look up pending transaction %s: status %d", entry.TxHash, resp.StatusCode)
+	}
+
+	if sequence >= entry.Sequence {
+		return false, nil
+	}
+
+	return false, errors.Errorf("pending transaction %s is not in the ledger, but may still get there", entry.TxHash)
+}
+
+// journalEntries returns entries with status for the instructions at indexes, and their
+// transaction hashes. Pending entries carry the sequence number of their transaction.
+func journalEntries(report *BatchReport, indexes []int, status string, sequence int64) []journalEntry {
+	entries := make([]journalEntry, 0, len(indexes))
+	for _, i := range indexes {
+		result := report.Results[i]
+		entries = append(entries, journalEntry{ID: result.Instruction.ID, TxHash: result.TxHash, Sequence: sequence, Status: status})
+	}
+
+	return entries
+}
+
+// writeJournal appends entries to the journal, and syncs it to disk.
+func writeJournal(journal *os.File, entries []journalEntry) error {
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if _, err := journal.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return journal.Sync()
+}
+
+// LoadPaymentInstructions reads payment instructions from a CSV (.csv) or JSON (.json) file.
+// See ParsePaymentsCSV and ParsePaymentsJSON for the formats.
+func LoadPaymentInstructions(path string) ([]PaymentInstruction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open payment instructions")
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ParsePaymentsCSV(file)
+	case ".json":
+		return ParsePaymentsJSON(file)
+	}
+
+	return nil, errors.Errorf("unknown payment instructions format: %s", path)
+}
+
+// ParsePaymentsJSON reads a JSON array of payment instructions from r.
+//
+//   [{"id": "1", "address": "G...", "amount": "10", "asset": {"code": "USD", "issuer": "G...", "type": "credit_alphanum4"}},
+//    {"id": "2", "address": "G...", "amount": "5"}]
+func ParsePaymentsJSON(r io.Reader) ([]PaymentInstruction, error) {
+	var instructions []PaymentInstruction
+	if err := json.NewDecoder(r).Decode(&instructions); err != nil {
+		return nil, errors.Wrap(err, "can't decode payment instructions")
+	}
+
+	return instructions, nil
+}
+
+// ParsePaymentsCSV reads payment instructions from CSV data in r. The first row is a header
+// naming the columns: address and amount are required, and id, asset_code, and asset_issuer
+// are optional. Rows without an asset code (or with code XLM and no issuer) pay lumens.
+//
+//   id,address,amount,asset_code,asset_issuer
+//   1,G...,10,USD,G...
+//   2,G...,5,,
+func ParsePaymentsCSV(r io.Reader) ([]PaymentInstruction, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read CSV header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"address", "amount"} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.Errorf("CSV is missing the %s column", required)
+		}
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+
+		return ""
+	}
+
+	instructions := []PaymentInstruction{}
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read CSV line %d", line)
+		}
+
+		instructions = append(instructions, PaymentInstruction{
+			ID:      field(row, "id"),
+			Address: field(row, "address"),
+			Amount:  field(row, "amount"),
+			Asset:   csvAsset(field(row, "asset_code"), field(row, "asset_issuer")),
+		})
+	}
+
+	return instructions, nil
+}
+
+// csvAsset returns the asset for a CSV row's asset code and issuer.
+func csvAsset(code string, issuer string) *Asset {
+	if code == "" || (issuer == "" && strings.EqualFold(code, "XLM")) {
+		return NativeAsset
+	}
+
+	return NewCreditAsset(code, issuer)
+}
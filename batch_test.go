@@ -0,0 +1,222 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestBatchPay(t *testing.T) {
+	var mu sync.Mutex
+	opCounts := []int{}
+	missing := "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"
+
+	funded := func(address string) (string, bool) {
+		return `"balances": [{"asset_type": "native", "balance": "10"}]`, address != missing
+	}
+
+	server := newFakeHorizon(funded, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/transactions" {
+			var envelope xdr.TransactionEnvelope
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			opCounts = append(opCounts, len(envelope.Tx.Operations))
+			fmt.Fprintf(w, `{"hash": "hash%d", "ledger": 2}`, len(opCounts))
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	instructions := []PaymentInstruction{}
+	for i := 0; i < 150; i++ {
+		pair, _ := ms.CreateKeyPair()
+		instructions = append(instructions, PaymentInstruction{Address: pair.Address, Amount: "1"})
+	}
+
+	USD := NewAsset("USD", testAddress, Credit4Type)
+	instructions = append(instructions,
+		PaymentInstruction{Address: "bad", Amount: "1"},
+		PaymentInstruction{Address: missing, Amount: "1"},
+		PaymentInstruction{Address: instructions[0].Address, Amount: "1", Asset: USD},
+		PaymentInstruction{Address: instructions[0].Address, Amount: "-1"},
+	)
+
+	journal := filepath.Join(t.TempDir(), "batch.journal")
+	report, err := ms.BatchPay(testOtherSeed, instructions, Opts().WithJournal(journal))
+	if err == nil {
+		t.Errorf("BatchPay should report invalid payments")
+	}
+
+	if len(opCounts) != 2 || opCounts[0] != 100 || opCounts[1] != 50 {
+		t.Errorf("want transactions of 100 and 50 payments, got %v", opCounts)
+	}
+
+	if report.Count(PaymentPaid) != 150 || report.Count(PaymentInvalid) != 4 {
+		t.Fatalf("unexpected report: %s", report)
+	}
+
+	if result := report.Results[149]; result.TxHash != "hash2" || result.Instruction.ID != "149" {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	if err := report.Results[152].Err; err == nil || !strings.Contains(err.Error(), "does not trust") {
+		t.Errorf("want trustline error, got %v", err)
+	}
+
+	// Resuming the batch skips the payments in the journal.
+	report, _ = ms.BatchPay(testOtherSeed, instructions, Opts().WithJournal(journal))
+	if len(opCounts) != 2 || report.Count(PaymentSkipped) != 150 || report.Results[0].TxHash != "hash1" {
+		t.Errorf("resumed batch should skip paid instructions: %s", report)
+	}
+}
+
+func TestBatchPayUnknownOutcome(t *testing.T) {
+	var mu sync.Mutex
+	submissions := 0
+	timeout, found := true, false
+	sourceSeq := 1
+	landOnLoad := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/transactions":
+			submissions++
+			if timeout {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				fmt.Fprint(w, `{"status": 504, "title": "Timeout"}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+		case strings.HasPrefix(r.URL.Path, "/transactions/"):
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"status": 404}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"hash": "abcd", "successful": true}`)
+		default:
+			address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+			fmt.Fprintf(w, `{"account_id": "%s", "sequence": "%d", "balances": [{"asset_type": "native", "balance": "10"}]}`, address, sourceSeq)
+
+			// The pending transaction lands right after the source account is loaded.
+			if landOnLoad && address == toAddress(testOtherSeed) {
+				found, sourceSeq = true, 5
+			}
+		}
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	instructions := []PaymentInstruction{{Address: testAddress, Amount: "1"}}
+	pay := func(journal string) *BatchReport {
+		report, _ := ms.BatchPay(testOtherSeed, instructions, Opts().WithJournal(journal))
+		return report
+	}
+
+	// Horizon times out, so the payment may or may not have been made.
+	journal := filepath.Join(t.TempDir(), "batch.journal")
+	report := pay(journal)
+	hash := report.Results[0].TxHash
+	if report.Count(PaymentUnknown) != 1 || hash == "" || submissions != 1 {
+		t.Fatalf("want unknown payment with a hash, got %s", report)
+	}
+
+	// The transaction isn't in the ledger, but it still could be, so it's not resubmitted.
+	mu.Lock()
+	timeout = false
+	mu.Unlock()
+
+	if report := pay(journal); report.Count(PaymentUnknown) != 1 || submissions != 1 {
+		t.Fatalf("pending payment should not be resubmitted: %s", report)
+	}
+
+	// The source account moved past the transaction, so it can't succeed, and is retried.
+	mu.Lock()
+	sourceSeq = 5
+	mu.Unlock()
+
+	if report := pay(journal); report.Count(PaymentPaid) != 1 || submissions != 2 {
+		t.Fatalf("lost payment should be retried: %s", report)
+	}
+
+	// The timed out transaction made it into the ledger, so the payment is skipped.
+	mu.Lock()
+	timeout, sourceSeq = true, 1
+	mu.Unlock()
+
+	journal = filepath.Join(t.TempDir(), "batch.journal")
+	pay(journal)
+
+	mu.Lock()
+	found = true
+	mu.Unlock()
+
+	report = pay(journal)
+	if report.Count(PaymentSkipped) != 1 || submissions != 3 {
+		t.Fatalf("successful pending payment should be skipped: %s", report)
+	}
+
+	// The resolved payment is journaled as paid, so it's not looked up again.
+	mu.Lock()
+	found = false
+	mu.Unlock()
+
+	if report := pay(journal); report.Count(PaymentSkipped) != 1 {
+		t.Errorf("resolved payment should stay skipped: %s", report)
+	}
+
+	// The transaction lands while it's being checked, so it's found, and not paid again.
+	journal = filepath.Join(t.TempDir(), "batch.journal")
+	pay(journal)
+
+	mu.Lock()
+	sourceSeq, landOnLoad = 1, true
+	mu.Unlock()
+
+	if report := pay(journal); report.Count(PaymentSkipped) != 1 || submissions != 4 {
+		t.Errorf("payment that landed during the check should be skipped: %s", report)
+	}
+}
+
+func TestLoadPaymentInstructions(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "payments.csv")
+	os.WriteFile(csvPath, []byte("address,amount,asset_code,asset_issuer,id\n"+
+		testAddress+",10,USD,"+testAddress+",a\n"+
+		testAddress+",5,,,b\n"), 0644)
+
+	instructions, err := LoadPaymentInstructions(csvPath)
+	if err != nil {
+		t.Fatalf("can't load CSV: %v", err)
+	}
+
+	if len(instructions) != 2 || instructions[0].ID != "a" || instructions[0].Asset.Code != "USD" || !instructions[1].Asset.IsNative() {
+		t.Errorf("bad CSV instructions: %+v", instructions)
+	}
+
+	jsonPath := filepath.Join(dir, "payments.json")
+	os.WriteFile(jsonPath, []byte(`[{"id": "a", "address": "`+testAddress+`", "amount": "10"}]`), 0644)
+
+	instructions, err = LoadPaymentInstructions(jsonPath)
+	if err != nil || len(instructions) != 1 || instructions[0].Amount != "10" {
+		t.Errorf("bad JSON instructions: %+v, %v", instructions, err)
+	}
+
+	if _, err := ParsePaymentsCSV(strings.NewReader("id,amount\n1,2\n")); err == nil {
+		t.Errorf("CSV without address should fail")
+	}
+}
@@ -0,0 +1,207 @@
+package microstellar
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+)
+
+// cacheEntry is a value stored in a ttlCache.
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache is a thread-safe map whose entries expire after a fixed TTL. A zero or
+// negative TTL disables the cache.
+type ttlCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+// newTTLCache returns an empty cache with the given TTL.
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// get returns the value stored for key, if it exists and has not expired.
+func (c *ttlCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if c.now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// set stores value for key.
+func (c *ttlCache) set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cacheEntry{value: value, expires: c.now().Add(c.ttl)}
+}
+
+// remove deletes the entry for key.
+func (c *ttlCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// clear deletes all entries.
+func (c *ttlCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]cacheEntry{}
+}
+
+// copyAccount returns a deep copy of account, so that cached accounts can't be changed through
+// the copies returned to callers.
+func copyAccount(account *Account) *Account {
+	copied := *account
+	copied.NativeBalance = copyBalance(account.NativeBalance)
+
+	if account.Balances != nil {
+		copied.Balances = make([]Balance, len(account.Balances))
+		for i, balance := range account.Balances {
+			copied.Balances[i] = copyBalance(balance)
+		}
+	}
+
+	if account.Signers != nil {
+		copied.Signers = append([]Signer{}, account.Signers...)
+	}
+
+	if account.Data != nil {
+		copied.Data = make(map[string]string, len(account.Data))
+		for key, value := range account.Data {
+			copied.Data[key] = value
+		}
+	}
+
+	return &copied
+}
+
+// copyBalance returns a copy of balance with its own asset.
+func copyBalance(balance Balance) Balance {
+	balance.Asset = copyAsset(balance.Asset)
+	return balance
+}
+
+// copyOrderBook returns a deep copy of orderBook, so that cached order books can't be changed
+// through the copies returned to callers.
+func copyOrderBook(orderBook *OrderBook) *OrderBook {
+	copied := *orderBook
+	copied.Base = copyAsset(orderBook.Base)
+	copied.Counter = copyAsset(orderBook.Counter)
+
+	if orderBook.Asks != nil {
+		copied.Asks = append([]BidAsk{}, orderBook.Asks...)
+	}
+
+	if orderBook.Bids != nil {
+		copied.Bids = append([]BidAsk{}, orderBook.Bids...)
+	}
+
+	return &copied
+}
+
+// copyAsset returns a copy of asset, or nil.
+func copyAsset(asset *Asset) *Asset {
+	if asset == nil {
+		return nil
+	}
+
+	copied := *asset
+	return &copied
+}
+
+// durationParam returns the time.Duration stored in params under key, or defaultValue if
+// the key is missing. Integer values are treated as seconds.
+func durationParam(params Params, key string, defaultValue time.Duration) time.Duration {
+	switch v := params[key].(type) {
+	case time.Duration:
+		return v
+	case int:
+		return time.Duration(v) * time.Second
+	case int64:
+		return time.Duration(v) * time.Second
+	}
+
+	return defaultValue
+}
+
+// toAddress returns the address for addressOrSeed. Invalid input is returned unchanged.
+func toAddress(addressOrSeed string) string {
+	if kp, err := keypair.Parse(addressOrSeed); err == nil {
+		return kp.Address()
+	}
+
+	return addressOrSeed
+}
+
+// touchedAccounts returns the addresses of accounts whose state tx may change: the source
+// account, operation source accounts, and the accounts that receive funds or trust.
+func touchedAccounts(tx *xdr.Transaction) []string {
+	addresses := []string{tx.SourceAccount.Address()}
+
+	for _, op := range tx.Operations {
+		if op.SourceAccount != nil {
+			addresses = append(addresses, op.SourceAccount.Address())
+		}
+
+		var account xdr.AccountId
+		switch op.Body.Type {
+		case xdr.OperationTypeCreateAccount:
+			account = op.Body.MustCreateAccountOp().Destination
+		case xdr.OperationTypeAllowTrust:
+			account = op.Body.MustAllowTrustOp().Trustor
+		default:
+			continue
+		}
+
+		addresses = append(addresses, account.Address())
+	}
+
+	return append(addresses, paymentDestinations(tx.Operations)...)
+}
+
+// invalidateTx drops cached state that tx may have changed. Order books are cleared
+// entirely, since any transaction can cross offers.
+func (ms *MicroStellar) invalidateTx(tx *xdr.Transaction) {
+	ms.orderBookCache.clear()
+	if tx == nil {
+		return
+	}
+
+	for _, address := range touchedAccounts(tx) {
+		debugf("invalidateTx", "invalidating cached account: %s", address)
+		ms.accountCache.remove(address)
+	}
+}
+
+// invalidateLedger drops all cached ledger state, when a new ledger closes.
+func (ms *MicroStellar) invalidateLedger() {
+	ms.accountCache.clear()
+	ms.orderBookCache.clear()
+}
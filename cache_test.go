@@ -0,0 +1,131 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAccountCache(t *testing.T) {
+	var loads int32
+	load := func(address string) (string, bool) {
+		atomic.AddInt32(&loads, 1)
+		return "", true
+	}
+
+	server := newFakeHorizon(load, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test", "account_ttl": time.Minute})
+	for i := 0; i < 3; i++ {
+		if _, err := ms.LoadAccount(testAddress); err != nil {
+			t.Fatalf("LoadAccount failed: %v", err)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("want 1 load, got %d", loads)
+	}
+
+	// Loading by seed uses the same entry.
+	ms.LoadAccount(testOtherSeed)
+	ms.LoadAccount(testOtherSeed)
+	if loads != 2 {
+		t.Errorf("want 2 loads, got %d", loads)
+	}
+
+	// Paying the account invalidates it.
+	if err := ms.PayNative(testOtherSeed, testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+		t.Fatalf("PayNative failed: %v", err)
+	}
+
+	before := loads
+	ms.LoadAccount(testAddress)
+	if loads != before+1 {
+		t.Errorf("payment should invalidate the destination")
+	}
+
+	ms.LoadAccount(testAddress)
+	ms.invalidateLedger()
+	ms.LoadAccount(testAddress)
+	if loads != before+2 {
+		t.Errorf("new ledgers should invalidate the cache")
+	}
+
+	// Caching is off by default.
+	ms = New("custom", Params{"url": server.URL, "passphrase": "test"})
+	before = loads
+	ms.LoadAccount(testAddress)
+	ms.LoadAccount(testAddress)
+	if loads != before+2 {
+		t.Errorf("cache should be disabled by default")
+	}
+}
+
+func TestCacheCopies(t *testing.T) {
+	var loads int32
+	load := func(address string) (string, bool) {
+		atomic.AddInt32(&loads, 1)
+		return fmt.Sprintf(`"data": {"key": "dmFsdWU="},
+			"balances": [{"asset_type": "credit_alphanum4", "asset_code": "USD", "asset_issuer": "%s", "balance": "5"}],
+			"signers": [{"public_key": "%s", "weight": 1}]`, testAddress, testAddress), true
+	}
+
+	server := newFakeHorizon(load, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transactions":
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+		case "/order_book":
+			fmt.Fprint(w, `{"asks": [{"price": "1.0", "amount": "10"}], "bids": [{"price": "0.5", "amount": "20"}],
+				"base": {"asset_type": "native"}, "counter": {"asset_type": "native"}}`)
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test", "account_ttl": time.Minute, "orderbook_ttl": time.Minute})
+
+	// Changing a returned account doesn't change the cached one.
+	account, _ := ms.LoadAccount(testAddress)
+	account.Balances[0].Amount = "100"
+	account.Balances[0].Asset.Code = "EUR"
+	account.Signers[0].Weight = 10
+	account.Data["key"] = "changed"
+
+	account, _ = ms.LoadAccount(testAddress)
+	if account.Balances[0].Amount != "5" || account.Balances[0].Asset.Code != "USD" || account.Signers[0].Weight != 1 || account.Data["key"] != "dmFsdWU=" {
+		t.Errorf("cached account was changed: %+v", account)
+	}
+
+	orderBook, _ := ms.LoadOrderBook(NativeAsset, NativeAsset)
+	orderBook.Asks[0].Amount = "0"
+	orderBook.Bids[0].Amount = "0"
+
+	orderBook, _ = ms.LoadOrderBook(NativeAsset, NativeAsset)
+	if orderBook.Asks[0].Amount != "10" || orderBook.Bids[0].Amount != "20" {
+		t.Errorf("cached order book was changed: %+v", orderBook)
+	}
+
+	// Payments through channels invalidate the parent's cache.
+	channel, _ := ms.CreateKeyPair()
+	pool, err := ms.NewChannelPool(testOtherSeed, []string{channel.Seed}, "")
+	if err != nil {
+		t.Fatalf("NewChannelPool failed: %v", err)
+	}
+
+	ms.LoadAccount(testAddress)
+	if err := pool.PayNative(testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+		t.Fatalf("PayNative failed: %v", err)
+	}
+
+	before := loads
+	ms.LoadAccount(testAddress)
+	if loads != before+1 {
+		t.Errorf("channel payment should invalidate the parent's cached destination")
+	}
+}
@@ -0,0 +1,128 @@
+package microstellar
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// ChannelPool spreads payments from a primary account across a set of channel accounts, so
+// that they can be submitted in parallel. Each payment leases a channel account as the
+// transaction source (which pays the fee and supplies the sequence number), while the payment
+// operation's source stays the primary account. Transactions are signed by both.
+//
+// ChannelPool is safe for concurrent use. Combine it with the "track_sequences" parameter to
+// avoid loading a channel's sequence number for every payment.
+//
+//   pool, err := ms.NewChannelPool("primary_seed", []string{"channel_seed1", "channel_seed2"}, "5")
+//   for _, payout := range payouts {
+//       go pool.PayNative(payout.Address, payout.Amount)
+//   }
+type ChannelPool struct {
+	ms       *MicroStellar
+	primary  string
+	channels chan string
+	size     int
+}
+
+// NewChannelPool returns a ChannelPool that pays from primarySeed through the channel accounts
+// channelSeeds. Channel accounts that don't exist are created and funded with fundAmount lumens
+// from the primary account; if fundAmount is empty, missing channels are an error.
+func (ms *MicroStellar) NewChannelPool(primarySeed string, channelSeeds []string, fundAmount string, options ...*Options) (*ChannelPool, error) {
+	if err := ValidSeed(primarySeed); err != nil {
+		return nil, ms.wrapf(err, "invalid primary seed")
+	}
+
+	if len(channelSeeds) == 0 {
+		return nil, ms.errorf("no channel accounts")
+	}
+
+	pool := &ChannelPool{
+		ms:       ms,
+		primary:  primarySeed,
+		channels: make(chan string, len(channelSeeds)),
+		size:     len(channelSeeds),
+	}
+
+	for _, channelSeed := range channelSeeds {
+		if err := ValidSeed(channelSeed); err != nil {
+			return nil, ms.wrapf(err, "invalid channel seed")
+		}
+
+		if !ms.fake {
+			address := toAddress(channelSeed)
+			_, err := ms.LoadAccount(address, options...)
+			if isNotFound(err) {
+				if fundAmount == "" {
+					return nil, ms.errorf("channel account %s does not exist", address)
+				}
+
+				debugf("NewChannelPool", "funding channel account %s", address)
+				err = ms.FundAccount(primarySeed, address, fundAmount, options...)
+			}
+
+			if err != nil {
+				return nil, ms.wrapf(err, "can't set up channel account %s", address)
+			}
+		}
+
+		pool.channels <- channelSeed
+	}
+
+	return pool, ms.success()
+}
+
+// Size returns the number of channel accounts in the pool.
+func (pool *ChannelPool) Size() int {
+	return pool.size
+}
+
+// lease waits for a free channel account, or until ctx is done.
+func (pool *ChannelPool) lease(ctx context.Context) (string, error) {
+	select {
+	case channel := <-pool.channels:
+		return channel, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// release returns channel to the pool.
+func (pool *ChannelPool) release(channel string) {
+	pool.channels <- channel
+}
+
+// Pay pays amount of asset from the primary account to targetAddress, through the next free
+// channel account. It blocks until a channel is free, or the context set with
+// Options.WithContext is done. Options work as they do for MicroStellar.Pay, except for
+// multi-op transactions, which are not supported.
+func (pool *ChannelPool) Pay(targetAddress string, amount string, asset *Asset, options ...*Options) error {
+	opts := *mergeOptions(options)
+	if opts.isMultiOp {
+		return errors.Errorf("can't pay through channels in a multi-op transaction")
+	}
+
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	channel, err := pool.lease(ctx)
+	if err != nil {
+		return errors.Wrap(err, "no free channel account")
+	}
+	defer pool.release(channel)
+
+	debugf("ChannelPool.Pay", "paying %s through channel %s", targetAddress, toAddress(channel))
+	opts.channelSeed = channel
+
+	// MicroStellar isn't thread-safe, so use a client per payment. It shares the parent's
+	// parameters (including any rate limiter and sequence tracker) and caches, so payments
+	// invalidate the accounts they touch in the parent.
+	return pool.ms.fork().Pay(pool.primary, targetAddress, amount, asset, &opts)
+}
+
+// PayNative pays amount lumens from the primary account to targetAddress. See Pay.
+func (pool *ChannelPool) PayNative(targetAddress string, amount string, options ...*Options) error {
+	return pool.Pay(targetAddress, amount, NativeAsset, options...)
+}
@@ -0,0 +1,101 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestChannelPool(t *testing.T) {
+	ms := New("fake")
+	primary, _ := ms.CreateKeyPair()
+	channel1, _ := ms.CreateKeyPair()
+	channel2, _ := ms.CreateKeyPair()
+	channels := []*KeyPair{channel1, channel2}
+
+	var mu sync.Mutex
+	existing := map[string]bool{primary.Address: true, channels[0].Address: true}
+	envelopes := []xdr.TransactionEnvelope{}
+
+	exists := func(address string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return "", existing[address]
+	}
+
+	server := newFakeHorizon(exists, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/transactions" {
+			var envelope xdr.TransactionEnvelope
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			envelopes = append(envelopes, envelope)
+
+			for _, op := range envelope.Tx.Operations {
+				if op.Body.Type == xdr.OperationTypeCreateAccount {
+					destination := op.Body.MustCreateAccountOp().Destination
+					existing[destination.Address()] = true
+				}
+			}
+
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+		}
+	})
+	defer server.Close()
+
+	ms = New("custom", Params{"url": server.URL, "passphrase": "test", "track_sequences": true})
+	if _, err := ms.NewChannelPool(primary.Seed, []string{channels[0].Seed, channels[1].Seed}, ""); err == nil {
+		t.Fatalf("missing channel should fail without a fund amount")
+	}
+
+	pool, err := ms.NewChannelPool(primary.Seed, []string{channels[0].Seed, channels[1].Seed}, "5")
+	if err != nil {
+		t.Fatalf("NewChannelPool failed: %v", err)
+	}
+
+	if len(envelopes) != 1 || !existing[channels[1].Address] {
+		t.Fatalf("missing channel should be funded")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.PayNative(testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+				t.Errorf("payment failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(envelopes) != 5 {
+		t.Fatalf("want 4 payments, got %d", len(envelopes)-1)
+	}
+
+	used := map[string]int{}
+	for _, envelope := range envelopes[1:] {
+		used[envelope.Tx.SourceAccount.Address()]++
+
+		op := envelope.Tx.Operations[0]
+		if op.SourceAccount == nil || op.SourceAccount.Address() != primary.Address {
+			t.Errorf("payment should come from the primary account")
+		}
+
+		if len(envelope.Signatures) != 2 {
+			t.Errorf("want signatures from primary and channel, got %d", len(envelope.Signatures))
+		}
+	}
+
+	if used[channels[0].Address] == 0 || used[channels[1].Address] == 0 || used[primary.Address] != 0 {
+		t.Errorf("payments should be spread across channels: %v", used)
+	}
+
+	if pool.Size() != 2 || len(pool.channels) != 2 {
+		t.Errorf("all channels should be released")
+	}
+}
@@ -0,0 +1,229 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizon"
+)
+
+// TxError is returned (wrapped) when Horizon rejects a transaction. It carries the transaction
+// and operation result codes, so callers don't need to parse error strings. Use AsTxError to
+// extract it from a returned error, or one of the Is* helpers:
+//
+//   err := ms.Pay("source_seed", "target_address", "3", microstellar.NativeAsset)
+//   if microstellar.IsUnderfunded(err) {
+//       log.Print("not enough lumens")
+//   }
+//
+//   if txErr := microstellar.AsTxError(err); txErr != nil {
+//       log.Printf("tx: %s, ops: %v, failed call: %s", txErr.TxCode, txErr.OpCodes, txErr.FailedMethod())
+//   }
+//
+// TxError's Cause is the underlying *horizon.Error, so ErrorString keeps working.
+type TxError struct {
+	HorizonError *horizon.Error
+
+	TxCode    string   // transaction result code, e.g., "tx_failed" or "tx_bad_seq"
+	OpCodes   []string // result code for each operation, e.g., "op_success" or "op_underfunded"
+	OpMethods []string // microstellar method (e.g., "Pay") that queued each operation, if known
+	Retryable bool     // true if a rebuilt transaction could succeed (see IsRetryable)
+}
+
+// retryableTxCodes are transaction result codes for which a rebuilt transaction can succeed.
+// Horizon reports them before the transaction is applied, so it can't also succeed.
+var retryableTxCodes = map[string]bool{
+	"tx_bad_seq":          true,
+	"tx_insufficient_fee": true,
+	"tx_too_late":         true,
+}
+
+// newTxError returns a *TxError for err if it is a horizon error, with opMethods mapped to
+// the operation result codes. Other errors are returned unchanged.
+func newTxError(err error, opMethods []string) error {
+	herr, ok := errors.Cause(err).(*horizon.Error)
+	if !ok {
+		return err
+	}
+
+	txErr := &TxError{HorizonError: herr}
+
+	if codes, cerr := herr.ResultCodes(); cerr == nil {
+		txErr.TxCode = codes.TransactionCode
+		txErr.OpCodes = codes.OperationCodes
+		txErr.Retryable = retryableTxCodes[codes.TransactionCode]
+	}
+
+	if len(opMethods) == len(txErr.OpCodes) {
+		txErr.OpMethods = opMethods
+	}
+
+	// Server errors (e.g., Horizon timing out while waiting for the transaction to make it into a
+	// ledger) aren't retryable: the transaction may still succeed, and so could a rebuilt one.
+	if isOutcomeUnknown(herr) {
+		txErr.Retryable = false
+	}
+
+	return txErr
+}
+
+// Error implements the error interface.
+func (e *TxError) Error() string {
+	msg := fmt.Sprintf("%d: %s", e.HorizonError.Problem.Status, e.HorizonError.Problem.Title)
+	if e.TxCode == "" {
+		return msg
+	}
+
+	msg += " (" + e.TxCode
+	failed := []string{}
+	for i, code := range e.OpCodes {
+		if code == "op_success" {
+			continue
+		}
+
+		if i < len(e.OpMethods) {
+			failed = append(failed, fmt.Sprintf("op %d (%s): %s", i, e.OpMethods[i], code))
+		} else {
+			failed = append(failed, fmt.Sprintf("op %d: %s", i, code))
+		}
+	}
+
+	if len(failed) > 0 {
+		msg += "; " + strings.Join(failed, ", ")
+	}
+
+	return msg + ")"
+}
+
+// Cause returns the underlying *horizon.Error.
+func (e *TxError) Cause() error {
+	return e.HorizonError
+}
+
+// Unwrap returns the underlying *horizon.Error.
+func (e *TxError) Unwrap() error {
+	return e.HorizonError
+}
+
+// FailedOp returns the index of the first failed operation, or -1 if no operation failed.
+func (e *TxError) FailedOp() int {
+	for i, code := range e.OpCodes {
+		if code != "op_success" {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// FailedMethod returns the microstellar method that queued the first failed operation, or
+// an empty string if it's unknown.
+func (e *TxError) FailedMethod() string {
+	if i := e.FailedOp(); i >= 0 && i < len(e.OpMethods) {
+		return e.OpMethods[i]
+	}
+
+	return ""
+}
+
+// HasCode returns true if the transaction result code or any operation result code is one of codes.
+func (e *TxError) HasCode(codes ...string) bool {
+	for _, code := range codes {
+		if e.TxCode == code {
+			return true
+		}
+
+		for _, opCode := range e.OpCodes {
+			if opCode == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AsTxError returns the *TxError in err's chain of causes, or nil if there isn't one.
+func AsTxError(err error) *TxError {
+	for err != nil {
+		if txErr, ok := err.(*TxError); ok {
+			return txErr
+		}
+
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// hasCode returns true if err is a *TxError that carries one of codes.
+func hasCode(err error, codes ...string) bool {
+	txErr := AsTxError(err)
+	return txErr != nil && txErr.HasCode(codes...)
+}
+
+// IsUnderfunded returns true if err failed because the source account didn't have enough funds.
+func IsUnderfunded(err error) bool {
+	return hasCode(err, "op_underfunded", "tx_insufficient_balance", "op_low_reserve")
+}
+
+// IsBadSequence returns true if err failed because of a bad sequence number. These errors are
+// retryable.
+func IsBadSequence(err error) bool {
+	return hasCode(err, "tx_bad_seq")
+}
+
+// IsNoTrust returns true if err failed because the source or destination account has no trust line
+// for the asset.
+func IsNoTrust(err error) bool {
+	return hasCode(err, "op_no_trust", "op_src_no_trust")
+}
+
+// IsBadAuth returns true if err failed because of missing or invalid signatures, or because an
+// account isn't authorized to hold the asset.
+func IsBadAuth(err error) bool {
+	return hasCode(err, "tx_bad_auth", "tx_bad_auth_extra", "op_bad_auth", "op_not_authorized", "op_src_not_authorized")
+}
+
+// IsRetryable returns true if err is a *TxError for a transaction that was rejected without being
+// applied, so that rebuilding it (with a new sequence number, fee, or time bounds) and submitting
+// it again can succeed, and can't make it apply twice. Submissions whose outcome is unknown (e.g.,
+// Horizon timed out) are not retryable: resubmit the same payload instead, which can only be
+// applied once.
+func IsRetryable(err error) bool {
+	txErr := AsTxError(err)
+	return txErr != nil && txErr.Retryable
+}
+
+// isNotFound returns true if err is a horizon 404, e.g., from loading an account that doesn't
+// exist.
+func isNotFound(err error) bool {
+	herr, ok := errors.Cause(err).(*horizon.Error)
+	return ok && herr.Response != nil && herr.Response.StatusCode == http.StatusNotFound
+}
+
+// isOutcomeUnknown returns true if err, from submitting a transaction, doesn't tell whether the
+// transaction made it into the ledger, e.g., because Horizon timed out or the connection dropped.
+// Horizon rejects transactions with 4xx errors.
+func isOutcomeUnknown(err error) bool {
+	herr, ok := errors.Cause(err).(*horizon.Error)
+	if !ok {
+		return true
+	}
+
+	status := herr.Problem.Status
+	if herr.Response != nil {
+		status = herr.Response.StatusCode
+	}
+
+	return status == 0 || status >= http.StatusInternalServerError
+}
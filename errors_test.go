@@ -0,0 +1,81 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizon"
+)
+
+// newFailingHorizon returns a test horizon server that serves accounts and rejects all
+// transactions with the given result codes.
+func newFailingHorizon(txCode string, opCodes ...string) *httptest.Server {
+	ops, _ := json.Marshal(opCodes)
+	return newFakeHorizon(nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"type": "transaction_failed", "title": "Transaction Failed", "status": 400,
+				"extras": {"result_codes": {"transaction": "%s", "operations": %s}}}`, txCode, ops)
+		}
+	})
+}
+
+func TestTxError(t *testing.T) {
+	server := newFailingHorizon("tx_failed", "op_success", "op_underfunded")
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	ms.Start(testOtherSeed, Opts().SkipMemoRequiredCheck())
+	ms.SetHomeDomain(testOtherSeed, "example.com")
+	ms.PayNative(testOtherSeed, testAddress, "10")
+
+	err := ms.Submit()
+	if err == nil {
+		t.Fatalf("submit should fail")
+	}
+
+	txErr := AsTxError(err)
+	if txErr == nil {
+		t.Fatalf("want *TxError, got %T: %v", errors.Cause(err), err)
+	}
+
+	if txErr.TxCode != "tx_failed" || len(txErr.OpCodes) != 2 || txErr.Retryable {
+		t.Errorf("bad TxError: %+v", txErr)
+	}
+
+	if txErr.FailedOp() != 1 || txErr.FailedMethod() != "Pay" {
+		t.Errorf("wrong failed op: %d (%s)", txErr.FailedOp(), txErr.FailedMethod())
+	}
+
+	if !IsUnderfunded(err) || IsBadSequence(err) || IsNoTrust(err) || IsBadAuth(err) {
+		t.Errorf("wrong classification for %v", err)
+	}
+
+	if s := ErrorString(err); !strings.Contains(s, "op_underfunded") {
+		t.Errorf("ErrorString should include result codes: %s", s)
+	}
+
+	server = newFailingHorizon("tx_bad_seq")
+	defer server.Close()
+
+	ms = New("custom", Params{"url": server.URL, "passphrase": "test"})
+	err = ms.SetHomeDomain(testOtherSeed, "example.com")
+	if !IsBadSequence(err) || !IsRetryable(err) {
+		t.Errorf("want retryable bad sequence error, got %v", err)
+	}
+
+	// Timeouts aren't retryable, since the transaction may still succeed.
+	err = newTxError(&horizon.Error{Problem: horizon.Problem{Status: http.StatusGatewayTimeout}}, nil)
+	if IsRetryable(err) {
+		t.Errorf("submission timeouts should not be retryable")
+	}
+
+	if IsUnderfunded(errors.New("some other error")) {
+		t.Errorf("non-horizon errors should not be classified")
+	}
+}
@@ -0,0 +1,460 @@
+package microstellar
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/horizon"
+)
+
+// Defaults for Horizon health checks. Override with the "health_interval" and "max_ledger_lag"
+// parameters.
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultMaxLedgerLag   = 10
+	healthProbeTimeout    = 5 * time.Second
+)
+
+// horizonEndpoint is the health state of a single Horizon instance.
+type horizonEndpoint struct {
+	url     string
+	healthy bool
+	ledger  int32 // latest ingested ledger
+	err     error // last probe error
+}
+
+// horizonPool tracks the health of a set of Horizon instances serving the same network. An
+// instance is healthy if its root endpoint responds, and its latest ingested ledger is within
+// maxLag ledgers of the newest instance. Health is probed lazily, at most once every interval,
+// and instances that fail requests are marked down until the next probe.
+type horizonPool struct {
+	mu        sync.Mutex
+	endpoints []*horizonEndpoint
+	active    int
+	probed    time.Time
+	probing   bool
+	interval  time.Duration
+	maxLag    int32
+	client    *http.Client
+}
+
+// horizonPoolParam returns the Horizon pool for the "urls" parameter, or nil if there are fewer
+// than two URLs. Clients created with New pass their pool in the "horizon_pool" parameter, so that
+// all their transactions share health state.
+func horizonPoolParam(params Params) *horizonPool {
+	if pool, ok := params["horizon_pool"].(*horizonPool); ok {
+		return pool
+	}
+
+	urls := urlsParam(params)
+	if len(urls) < 2 {
+		return nil
+	}
+
+	interval := durationParam(params, "health_interval", defaultHealthInterval)
+	maxLag := int32(defaultMaxLedgerLag)
+	if lag, ok := params["max_ledger_lag"].(int); ok {
+		maxLag = int32(lag)
+	}
+
+	pool := &horizonPool{
+		interval: interval,
+		maxLag:   maxLag,
+		client:   newHorizonHTTPClient(params),
+	}
+
+	for _, u := range urls {
+		// Assume instances are healthy until the first probe.
+		pool.endpoints = append(pool.endpoints, &horizonEndpoint{url: strings.TrimRight(u, "/"), healthy: true})
+	}
+
+	return pool
+}
+
+// base returns the URL that clients build requests against. Requests are rewritten to the
+// active instance by failoverTransport.
+func (p *horizonPool) base() string {
+	return p.endpoints[0].url
+}
+
+// probe checks the health of all instances concurrently, if it's been interval since the last
+// probe. Instances are probed without holding p.mu, so that requests aren't held up by slow
+// instances: they use the last known health while the probe runs.
+func (p *horizonPool) probe() {
+	p.mu.Lock()
+	if p.probing || time.Since(p.probed) <= p.interval {
+		p.mu.Unlock()
+		return
+	}
+
+	p.probing = true
+	p.mu.Unlock()
+
+	ledgers := make([]int32, len(p.endpoints))
+	errs := make([]error, len(p.endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range p.endpoints {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			ledgers[i], errs[i] = p.probeLedger(u)
+		}(i, endpoint.url)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	newest := int32(0)
+	for i := range p.endpoints {
+		if errs[i] == nil && ledgers[i] > newest {
+			newest = ledgers[i]
+		}
+	}
+
+	for i, endpoint := range p.endpoints {
+		endpoint.ledger, endpoint.err = ledgers[i], errs[i]
+		endpoint.healthy = endpoint.err == nil && newest-endpoint.ledger <= p.maxLag
+		debugf("horizonPool.probe", "%s: healthy=%v ledger=%d err=%v", endpoint.url, endpoint.healthy, endpoint.ledger, endpoint.err)
+	}
+
+	p.probed = time.Now()
+	p.probing = false
+	if !p.endpoints[p.active].healthy {
+		p.selectHealthy()
+	}
+}
+
+// probeLedger returns the latest ledger ingested by the instance at u.
+func (p *horizonPool) probeLedger(u string) (int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("root returned status %d", resp.StatusCode)
+	}
+
+	var root horizon.Root
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return 0, errors.Wrap(err, "bad root response")
+	}
+
+	return root.HorizonSequence, nil
+}
+
+// selectHealthy makes the first healthy instance after the active one active. Must be called
+// with p.mu held.
+func (p *horizonPool) selectHealthy() {
+	for i := 1; i <= len(p.endpoints); i++ {
+		next := (p.active + i) % len(p.endpoints)
+		if p.endpoints[next].healthy {
+			p.active = next
+			return
+		}
+	}
+}
+
+// candidates returns the instances to try for a request: the active one first, followed by
+// the other healthy ones. If none are healthy, all instances are returned.
+func (p *horizonPool) candidates() []string {
+	p.probe()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	urls := []string{}
+	for i := range p.endpoints {
+		endpoint := p.endpoints[(p.active+i)%len(p.endpoints)]
+		if endpoint.healthy {
+			urls = append(urls, endpoint.url)
+		}
+	}
+
+	if len(urls) == 0 {
+		for _, endpoint := range p.endpoints {
+			urls = append(urls, endpoint.url)
+		}
+	}
+
+	return urls
+}
+
+// current returns the active instance.
+func (p *horizonPool) current() string {
+	return p.candidates()[0]
+}
+
+// markDown marks the instance at u unhealthy until the next probe, and switches to another
+// healthy instance if u is active.
+func (p *horizonPool) markDown(u string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, endpoint := range p.endpoints {
+		if endpoint.url == u {
+			debugf("horizonPool.markDown", "marking %s down", u)
+			endpoint.healthy = false
+			if i == p.active {
+				p.selectHealthy()
+			}
+		}
+	}
+}
+
+// failoverTransport is an http.RoundTripper that sends requests addressed to the pool's base URL
+// to the active Horizon instance, and retries on other healthy instances if the request can't be
+// sent or the instance is unavailable.
+type failoverTransport struct {
+	pool *horizonPool
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.pool.base()
+	original := req.URL.String()
+	if !strings.HasPrefix(original, base) {
+		return t.next.RoundTrip(req)
+	}
+
+	suffix := strings.TrimPrefix(original, base)
+	candidates := t.pool.candidates()
+
+	var lastErr error
+	for i, endpoint := range candidates {
+		u, err := url.Parse(endpoint + suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		attempt := req.Clone(req.Context())
+		attempt.URL = u
+		attempt.Host = u.Host
+
+		if i > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				// The body can't be replayed, so don't retry.
+				break
+			}
+
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.next.RoundTrip(attempt)
+		if err == nil && (!unavailableStatus(resp.StatusCode) || submissionTimeout(req, resp)) {
+			return resp, nil
+		}
+
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+
+		t.pool.markDown(endpoint)
+		if err == nil {
+			if i == len(candidates)-1 {
+				return resp, nil
+			}
+
+			resp.Body.Close()
+			err = errors.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+		}
+
+		debugf("failoverTransport", "request to %s failed, failing over: %v", endpoint, err)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// unavailableStatus returns true if status indicates that the instance (rather than the request)
+// is at fault.
+func unavailableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// submissionTimeout returns true if resp is Horizon timing out while waiting for a submitted
+// transaction to make it into a ledger. The instance is fine, and the transaction may still
+// succeed, so the response is passed on as is.
+func submissionTimeout(req *http.Request, resp *http.Response) bool {
+	return resp.StatusCode == http.StatusGatewayTimeout && req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/transactions")
+}
+
+// withFailover returns a copy of client that sends Horizon requests through pool.
+func withFailover(client *http.Client, pool *horizonPool) *http.Client {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	failover := *client
+	failover.Transport = &failoverTransport{pool: pool, next: transport}
+	return &failover
+}
+
+// urlsParam returns the "urls" parameter as a string slice.
+func urlsParam(params Params) []string {
+	switch urls := params["urls"].(type) {
+	case []string:
+		return urls
+	case string:
+		return strings.Split(urls, ",")
+	}
+
+	return nil
+}
+
+// stream runs a horizon stream with fn, passing it a client for a healthy instance. If the stream
+// fails and tx has several Horizon instances, the instance is marked down and the stream is
+// restarted on another one, from the last paging token passed to seen.
+func (tx *Tx) stream(ctx context.Context, cursor *horizon.Cursor, fn func(client *horizon.Client, cursor *horizon.Cursor, seen func(pagingToken string)) error) error {
+	seen := func(pagingToken string) {
+		c := horizon.Cursor(pagingToken)
+		cursor = &c
+	}
+
+	for {
+		client := tx.client
+		if tx.pool != nil {
+			client = &horizon.Client{URL: tx.pool.current(), HTTP: tx.client.HTTP}
+		}
+
+		err := fn(client, cursor, seen)
+		if err == nil || ctx.Err() != nil || tx.pool == nil || len(tx.pool.endpoints) < 2 {
+			return err
+		}
+
+		debugf("Tx.stream", "stream from %s failed, reconnecting: %v", client.URL, err)
+		tx.pool.markDown(client.URL)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// streamEvents reads the server-sent events at endpoint, starting after cursor, and calls handler
+// with the data of each message. Unlike the horizon library's Stream* methods, the requests go
+// through tx's HTTP client, so streams get the "http_client", "headers" and "middleware"
+// parameters. When Horizon closes the stream, it reconnects from the last event ID. Returns nil
+// once ctx is done.
+func (tx *Tx) streamEvents(ctx context.Context, endpoint string, cursor *horizon.Cursor, handler func(data []byte) error) error {
+	// Streams stay open indefinitely, so the client's request timeout doesn't apply.
+	client := *tx.httpClient
+	client.Timeout = 0
+
+	query := url.Values{}
+	if cursor != nil {
+		query.Set("cursor", string(*cursor))
+	}
+
+	for {
+		req, err := http.NewRequest("GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return errors.Wrap(err, "could not create stream request")
+		}
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "stream request failed")
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return errors.Errorf("stream request failed with status %d", resp.StatusCode)
+		}
+
+		err = readEvents(resp.Body, func(id string, data []byte) error {
+			if id != "" {
+				query.Set("cursor", id)
+			}
+			return handler(data)
+		})
+		resp.Body.Close()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// readEvents parses server-sent events from r until EOF, and calls fn with the ID and data of each
+// message event. Other event types (e.g., Horizon's "open") are skipped.
+func readEvents(r io.Reader, fn func(id string, data []byte) error) error {
+	reader := bufio.NewReader(r)
+	var event, id string
+	var data []string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" && err == nil {
+			if len(data) > 0 && (event == "" || event == "message") {
+				if err := fn(id, []byte(strings.Join(data, "\n"))); err != nil {
+					return err
+				}
+			}
+
+			event, id, data = "", "", nil
+		} else if !strings.HasPrefix(line, ":") {
+			field, value := line, ""
+			if i := strings.Index(line, ":"); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+
+			switch field {
+			case "event":
+				event = value
+			case "data":
+				data = append(data, value)
+			case "id":
+				id = value
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestHorizon returns a test horizon server at the given ledger that serves accounts, or
+// fails all non-root requests with 503 if down is set.
+func newTestHorizon(ledger int, down bool, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `{"history_latest_ledger": %d}`, ledger)
+			return
+		}
+
+		atomic.AddInt32(hits, 1)
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1"}`, strings.TrimPrefix(r.URL.Path, "/accounts/"))
+	}))
+}
+
+func TestFailover(t *testing.T) {
+	var hits1, hits2 int32
+
+	// The first instance is reachable, but lagging.
+	lagging := newTestHorizon(100, false, &hits1)
+	defer lagging.Close()
+	healthy := newTestHorizon(200, false, &hits2)
+	defer healthy.Close()
+
+	ms := New("custom", Params{"urls": []string{lagging.URL, healthy.URL}, "passphrase": "test"})
+	if _, err := ms.LoadAccount(testAddress); err != nil {
+		t.Fatalf("LoadAccount failed: %v", err)
+	}
+
+	if hits1 != 0 || hits2 != 1 {
+		t.Errorf("lagging instance should be skipped: got %d, %d hits", hits1, hits2)
+	}
+
+	// The first instance is down.
+	hits1, hits2 = 0, 0
+	down := newTestHorizon(200, true, &hits1)
+	defer down.Close()
+	up := newTestHorizon(200, false, &hits2)
+	defer up.Close()
+
+	ms = New("custom", Params{"urls": []string{down.URL, up.URL}, "passphrase": "test"})
+	for i := 0; i < 2; i++ {
+		if _, err := ms.LoadAccount(testAddress); err != nil {
+			t.Fatalf("LoadAccount failed: %v", err)
+		}
+	}
+
+	if hits1 != 1 || hits2 != 2 {
+		t.Errorf("should fail over once and stay on the healthy instance: got %d, %d hits", hits1, hits2)
+	}
+
+	// Horizon timing out on a submission doesn't mark the instance down.
+	hits1, hits2 = 0, 0
+	timeout := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `{"history_latest_ledger": 200}`)
+		case "/transactions":
+			atomic.AddInt32(&hits1, 1)
+			w.WriteHeader(http.StatusGatewayTimeout)
+			fmt.Fprint(w, `{"status": 504, "title": "Timeout"}`)
+		default:
+			atomic.AddInt32(&hits1, 1)
+			fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1"}`, strings.TrimPrefix(r.URL.Path, "/accounts/"))
+		}
+	}))
+	defer timeout.Close()
+
+	ms = New("custom", Params{"urls": []string{timeout.URL, up.URL}, "passphrase": "test"})
+	err := ms.PayNative(testOtherSeed, testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck())
+	if txErr := AsTxError(err); txErr == nil || txErr.HorizonError.Problem.Status != http.StatusGatewayTimeout {
+		t.Fatalf("want 504 error, got %v", err)
+	}
+
+	ms.LoadAccount(testAddress)
+	if hits1 != 3 || hits2 != 0 {
+		t.Errorf("submission timeout should not fail over: got %d, %d hits", hits1, hits2)
+	}
+
+	// With a single URL, there's no failover.
+	ms = New("custom", Params{"urls": []string{down.URL}, "passphrase": "test"})
+	if _, err := ms.LoadAccount(testAddress); err == nil {
+		t.Errorf("LoadAccount should fail")
+	}
+
+	// A single URL replaces the default server on the public and test networks.
+	hits2 = 0
+	ms = New("test", Params{"urls": []string{up.URL}})
+	if _, err := ms.LoadAccount(testAddress); err != nil || hits2 != 1 {
+		t.Errorf("single url should be used on test network: err=%v hits=%d", err, hits2)
+	}
+}
+
+func TestFailoverProbeHeaders(t *testing.T) {
+	var mu sync.Mutex
+	probeKeys := map[string]bool{}
+	probe := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			mu.Lock()
+			probeKeys[r.Header.Get("X-Api-Key")] = true
+			mu.Unlock()
+			fmt.Fprint(w, `{"history_latest_ledger": 200}`)
+		}
+	}
+
+	server1 := newFakeHorizon(nil, probe)
+	defer server1.Close()
+	server2 := newFakeHorizon(nil, probe)
+	defer server2.Close()
+
+	// Clients for the same instances probe them with their own credentials.
+	for _, key := range []string{"a", "b"} {
+		ms := New("custom", Params{
+			"urls":       []string{server1.URL, server2.URL},
+			"passphrase": "test",
+			"headers":    map[string]string{"X-Api-Key": key},
+		})
+
+		if _, err := ms.LoadAccount(testAddress); err != nil {
+			t.Fatalf("LoadAccount failed: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(probeKeys) != 2 || !probeKeys["a"] || !probeKeys["b"] {
+		t.Errorf("probes should use each client's headers, got %v", probeKeys)
+	}
+}
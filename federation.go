@@ -0,0 +1,334 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/federation"
+	"github.com/stellar/go/clients/stellartoml"
+	proto "github.com/stellar/go/protocols/federation"
+)
+
+// ErrFederationNotFound is returned by a Resolver if it has no record for the query. The
+// federation handler responds with a 404 for this error.
+var ErrFederationNotFound = errors.New("federation record not found")
+
+// FederationRecord is a federation lookup result. Address is the federated address (e.g.,
+// "mo*example.com"), and MemoType and Memo are the memo that payments to the address should carry.
+type FederationRecord struct {
+	Address   string `json:"stellar_address,omitempty"`
+	AccountID string `json:"account_id"`
+	MemoType  string `json:"memo_type,omitempty"`
+	Memo      string `json:"memo,omitempty"`
+}
+
+// federationResponse is the wire format of a federation server response. Memos can be strings
+// or integers.
+type federationResponse struct {
+	Address   string     `json:"stellar_address"`
+	AccountID string     `json:"account_id"`
+	MemoType  string     `json:"memo_type"`
+	Memo      proto.Memo `json:"memo"`
+	Detail    string     `json:"detail"`
+}
+
+// defaultFederationTTL is how long federated address lookups are cached by default.
+const defaultFederationTTL = 5 * time.Minute
+
+// lookupAddress resolves the federated address, using cached results if available.
+func (ms *MicroStellar) lookupAddress(address string, options []*Options) (*FederationRecord, error) {
+	key := strings.ToLower(address)
+	if cached, ok := ms.federationCache.get(key); ok {
+		debugf("lookupAddress", "cache hit: %s", address)
+		return cached.(*FederationRecord), nil
+	}
+
+	client := ms.httpClient(options)
+	fedClient := &federation.Client{
+		HTTP:        client,
+		Horizon:     ms.queryTx(options).GetClient(),
+		StellarTOML: &stellartoml.Client{HTTP: client},
+	}
+
+	resp, err := fedClient.LookupByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &FederationRecord{
+		Address:   address,
+		AccountID: resp.AccountID,
+		MemoType:  resp.MemoType,
+		Memo:      resp.Memo.String(),
+	}
+
+	ms.federationCache.set(key, record)
+	return record, nil
+}
+
+// resolveTarget resolves a federated payment target, and returns its account ID along with options
+// that carry the memo required by the federation server. Non-federated targets are returned as is.
+func (ms *MicroStellar) resolveTarget(target string, options []*Options) (string, []*Options, error) {
+	if !strings.Contains(target, "*") {
+		return target, options, nil
+	}
+
+	record, err := ms.lookupAddress(target, options)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "could not resolve %s", target)
+	}
+
+	if record.MemoType == "" {
+		return record.AccountID, options, nil
+	}
+
+	required := NewOptions()
+	if err := required.setMemo(record.MemoType, record.Memo); err != nil {
+		return "", nil, errors.Wrapf(err, "bad memo for %s", target)
+	}
+
+	// Copy the options so the caller's (or the multi-op transaction's) options are left untouched.
+	var opts Options
+	switch {
+	case len(options) > 0:
+		opts = *options[0]
+	case ms.tx != nil && ms.tx.options != nil:
+		opts = *ms.tx.options
+	default:
+		opts = *NewOptions()
+	}
+	opts.isMultiOp = false
+
+	if opts.memoType != MemoNone && !opts.sameMemo(required) {
+		return "", nil, errors.Errorf("memo conflicts with the %s memo required by %s", record.MemoType, target)
+	}
+
+	opts.setMemo(record.MemoType, record.Memo)
+	return record.AccountID, []*Options{&opts}, nil
+}
+
+// ResolveAccountID performs a reverse federation lookup, and returns the federated address
+// (e.g., "mo*example.com") for accountID. If domain is empty, the federation server of the
+// account's home domain is used.
+//
+//   address, err := ms.ResolveAccountID("GAUYTZ24ATLEBIV63MXMPOPQO2T6NHI6TQYEXRTFYXWYZ3JOCVO6UYUM", "")
+func (ms *MicroStellar) ResolveAccountID(accountID string, domain string, options ...*Options) (string, error) {
+	if err := ValidAddress(accountID); err != nil {
+		return "", ms.wrapf(err, "can't resolve account ID")
+	}
+
+	if domain == "" {
+		account, err := ms.LoadAccount(accountID, options...)
+		if err != nil {
+			return "", ms.wrapf(err, "can't resolve account ID")
+		}
+
+		if account.HomeDomain == "" {
+			return "", ms.errorf("can't resolve account ID: %s has no home domain", accountID)
+		}
+		domain = account.HomeDomain
+	}
+
+	record, err := ms.queryFederation(domain, "id", accountID, options)
+	if err != nil {
+		return "", ms.wrapf(err, "can't resolve account ID")
+	}
+
+	if record.Address == "" {
+		return "", ms.errorf("can't resolve account ID: no address for %s", accountID)
+	}
+
+	return record.Address, ms.success()
+}
+
+// ResolveTxID looks up a transaction ID on domain's federation server, and returns the federation
+// record of the transaction's sender.
+func (ms *MicroStellar) ResolveTxID(txID string, domain string, options ...*Options) (*FederationRecord, error) {
+	if txID == "" {
+		return nil, ms.errorf("can't resolve transaction ID: empty ID")
+	}
+
+	record, err := ms.queryFederation(domain, "txid", txID, options)
+	if err != nil {
+		return nil, ms.wrapf(err, "can't resolve transaction ID")
+	}
+
+	return record, ms.success()
+}
+
+// queryFederation looks up domain's federation server in its stellar.toml, and sends it a query.
+func (ms *MicroStellar) queryFederation(domain string, queryType string, q string, options []*Options) (*FederationRecord, error) {
+	client := ms.httpClient(options)
+
+	var doc StellarTOML
+	if err := loadTOML(client, domain, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.FederationServer == "" {
+		return nil, errors.Errorf("%s has no federation server", domain)
+	}
+
+	if !strings.HasPrefix(doc.FederationServer, "https://") {
+		return nil, errors.Errorf("non-https federation server disallowed: %s", doc.FederationServer)
+	}
+
+	return lookupFederation(client, doc.FederationServer, queryType, q)
+}
+
+// lookupFederation sends a query of queryType to the federation server at endpoint.
+func lookupFederation(client *contextHTTP, endpoint string, queryType string, q string) (*FederationRecord, error) {
+	query := url.Values{}
+	query.Set("type", queryType)
+	query.Set("q", q)
+
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+
+	debugf("lookupFederation", "querying: %s%s%s", endpoint, separator, query.Encode())
+	resp, err := client.Get(endpoint + separator + query.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "federation request failed")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errors.Wrap(ErrFederationNotFound, q)
+	}
+
+	var result federationResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return nil, errors.Wrap(err, "bad federation response")
+	}
+
+	if result.Detail != "" {
+		return nil, errors.Errorf("federation request failed: %s", result.Detail)
+	}
+
+	if result.AccountID == "" && result.Address == "" {
+		return nil, errors.Errorf("empty federation response")
+	}
+
+	if result.MemoType != "" && result.Memo.String() == "" {
+		return nil, errors.Errorf("invalid federation response: memo_type without memo")
+	}
+
+	return &FederationRecord{
+		Address:   result.Address,
+		AccountID: result.AccountID,
+		MemoType:  result.MemoType,
+		Memo:      result.Memo.String(),
+	}, nil
+}
+
+// Resolver looks up federation records for a federation server. Return ErrFederationNotFound
+// if there is no record for the query.
+type Resolver interface {
+	// LookupByName returns the record for the federated address name*domain.
+	LookupByName(name string, domain string) (*FederationRecord, error)
+
+	// LookupByAccountID returns the record (with Address set) for accountID.
+	LookupByAccountID(accountID string) (*FederationRecord, error)
+}
+
+// TxIDResolver is an optional interface implemented by Resolvers that support transaction ID
+// ("txid") lookups.
+type TxIDResolver interface {
+	LookupByTxID(txID string) (*FederationRecord, error)
+}
+
+// NewFederationHandler returns an http.Handler that implements a SEP-2 federation server for
+// addresses on domain, backed by resolver. Set FEDERATION_SERVER in your stellar.toml to the
+// URL the handler is served on.
+//
+//   http.Handle("/federation", microstellar.NewFederationHandler("example.com", resolver))
+//   log.Fatal(http.ListenAndServeTLS(":443", "cert.pem", "key.pem", nil))
+func NewFederationHandler(domain string, resolver Resolver) http.Handler {
+	return &federationHandler{domain: strings.ToLower(domain), resolver: resolver}
+}
+
+// federationHandler is the http.Handler returned by NewFederationHandler.
+type federationHandler struct {
+	domain   string
+	resolver Resolver
+}
+
+// ServeHTTP implements http.Handler.
+func (h *federationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		h.writeError(w, http.StatusBadRequest, "missing q parameter")
+		return
+	}
+
+	var record *FederationRecord
+	var err error
+
+	switch queryType := r.URL.Query().Get("type"); queryType {
+	case "name":
+		parts := strings.SplitN(q, "*", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			h.writeError(w, http.StatusBadRequest, "invalid federated address")
+			return
+		}
+
+		if strings.ToLower(parts[1]) != h.domain {
+			h.writeError(w, http.StatusNotFound, "unknown domain")
+			return
+		}
+
+		record, err = h.resolver.LookupByName(parts[0], h.domain)
+		if err == nil && record != nil && record.Address == "" {
+			record.Address = q
+		}
+	case "id":
+		if ValidAddress(q) != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid account ID")
+			return
+		}
+
+		record, err = h.resolver.LookupByAccountID(q)
+		if err == nil && record != nil && record.AccountID == "" {
+			record.AccountID = q
+		}
+	case "txid":
+		txResolver, ok := h.resolver.(TxIDResolver)
+		if !ok {
+			h.writeError(w, http.StatusNotImplemented, "txid lookups not supported")
+			return
+		}
+
+		record, err = txResolver.LookupByTxID(q)
+	default:
+		h.writeError(w, http.StatusNotImplemented, "unsupported query type: "+queryType)
+		return
+	}
+
+	if errors.Cause(err) == ErrFederationNotFound || (err == nil && record == nil) {
+		h.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if err != nil {
+		debugf("federationHandler", "lookup of %s failed: %v", q, err)
+		h.writeError(w, http.StatusInternalServerError, "lookup failed")
+		return
+	}
+
+	json.NewEncoder(w).Encode(record)
+}
+
+// writeError writes a federation error response.
+func (h *federationHandler) writeError(w http.ResponseWriter, status int, detail string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
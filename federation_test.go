@@ -0,0 +1,118 @@
+package microstellar
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testResolver is a map-backed Resolver and TxIDResolver.
+type testResolver map[string]*FederationRecord
+
+func (r testResolver) LookupByName(name string, domain string) (*FederationRecord, error) {
+	if record, ok := r[name]; ok {
+		return &FederationRecord{AccountID: record.AccountID, MemoType: record.MemoType, Memo: record.Memo}, nil
+	}
+
+	return nil, ErrFederationNotFound
+}
+
+func (r testResolver) LookupByAccountID(accountID string) (*FederationRecord, error) {
+	for name, record := range r {
+		if record.AccountID == accountID {
+			return &FederationRecord{Address: name + "*example.com"}, nil
+		}
+	}
+
+	return nil, ErrFederationNotFound
+}
+
+func (r testResolver) LookupByTxID(txID string) (*FederationRecord, error) {
+	if txID == "tx1" {
+		return &FederationRecord{Address: "mo*example.com", AccountID: testAddress}, nil
+	}
+
+	return nil, errors.New("database is down")
+}
+
+func TestFederationHandler(t *testing.T) {
+	resolver := testResolver{
+		"mo": {AccountID: testAddress, MemoType: "id", Memo: "42"},
+	}
+
+	server := httptest.NewServer(NewFederationHandler("Example.com", resolver))
+	defer server.Close()
+
+	record, err := lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "name", "mo*example.com")
+	if err != nil {
+		t.Fatalf("name lookup: %v", err)
+	}
+
+	want := FederationRecord{Address: "mo*example.com", AccountID: testAddress, MemoType: "id", Memo: "42"}
+	if *record != want {
+		t.Errorf("wrong record: want %+v, got %+v", want, *record)
+	}
+
+	record, err = lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "id", testAddress)
+	if err != nil {
+		t.Fatalf("id lookup: %v", err)
+	}
+
+	if record.Address != "mo*example.com" || record.AccountID != testAddress {
+		t.Errorf("wrong record for id lookup: %+v", *record)
+	}
+
+	if record, err = lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "txid", "tx1"); err != nil || record.Address != "mo*example.com" {
+		t.Errorf("txid lookup: %+v, %v", record, err)
+	}
+
+	for _, q := range []string{"bob*example.com", "mo*other.com"} {
+		if _, err := lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "name", q); errors.Cause(err) != ErrFederationNotFound {
+			t.Errorf("%s: want ErrFederationNotFound, got %v", q, err)
+		}
+	}
+
+	if _, err := lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "txid", "tx2"); err == nil {
+		t.Errorf("resolver errors should fail the lookup")
+	}
+
+	if _, err := lookupFederation(newContextHTTP(nil, nil, 0), server.URL, "forward", "x"); err == nil {
+		t.Errorf("unsupported query types should fail")
+	}
+}
+
+func TestPayFederatedAddress(t *testing.T) {
+	ms := New("fake")
+	ms.federationCache.set("mo*example.com", &FederationRecord{
+		Address:   "mo*example.com",
+		AccountID: testAddress,
+		MemoType:  "id",
+		Memo:      "42",
+	})
+
+	if address, err := ms.Resolve("Mo*example.com"); err != nil || address != testAddress {
+		t.Errorf("Resolve: %v, %v", address, err)
+	}
+
+	if err := ms.PayNative(testOtherSeed, "mo*example.com", "10"); err != nil {
+		t.Fatalf("PayNative: %v", err)
+	}
+
+	if opts := ms.lastTx.options; opts == nil || opts.memoType != MemoID || opts.memoID != 42 {
+		t.Errorf("federation memo was not applied: %+v", opts)
+	}
+
+	if err := ms.PayNative(testOtherSeed, "mo*example.com", "10", Opts().WithMemoID(42)); err != nil {
+		t.Errorf("matching memo should be allowed: %v", err)
+	}
+
+	opts := Opts().WithMemoText("hello")
+	if err := ms.PayNative(testOtherSeed, "mo*example.com", "10", opts); err == nil {
+		t.Errorf("conflicting memo should fail")
+	}
+
+	if opts.memoType != MemoText {
+		t.Errorf("caller's options should not be modified")
+	}
+}
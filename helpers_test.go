@@ -0,0 +1,52 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// Keys shared by tests. The accounts only exist on the fake Horizon servers that tests start.
+const (
+	testSeed      = "SAJ4FP6H3FSTE4P7UOONX6ULQ4UKDMK7XXDDKGYTO6ZCRIF2ZU6LZM3D"
+	testAddress   = "GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"
+	testOtherSeed = "SA6UC3LRJVNZ6DO3ZIBWUXHG6O7LKWWFTTAG2HK6QHSXZROMCVDU73RH"
+)
+
+// newFakeHorizon returns a test Horizon server. Requests for /accounts/<address> get an account
+// with sequence number 1 and the extra JSON fields returned by account (e.g., `"subentry_count": 2`),
+// or a 404 if account returns false. If account is nil, every account exists. Other requests go
+// to handler, or get a 404 if handler is nil.
+func newFakeHorizon(account func(address string) (string, bool), handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/accounts/") {
+			if handler != nil {
+				handler(w, r)
+				return
+			}
+
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": 404, "title": "Resource Missing"}`)
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		fields, ok := "", true
+		if account != nil {
+			fields, ok = account(address)
+		}
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": 404, "title": "Resource Missing"}`)
+			return
+		}
+
+		if fields != "" {
+			fields = ", " + fields
+		}
+
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1"%s}`, address, fields)
+	}))
+}
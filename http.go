@@ -0,0 +1,216 @@
+package microstellar
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpGetter is implemented by *http.Client and contextHTTP.
+type httpGetter interface {
+	Get(url string) (*http.Response, error)
+}
+
+// contextHTTP is the HTTP client used for all requests to Horizon, federation servers, and
+// anchors. It attaches ctx to every request, so that callers can cancel them, and applies
+// timeout to each request. It implements the HTTP interfaces of the horizon, federation, and
+// stellartoml clients.
+type contextHTTP struct {
+	client  *http.Client
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// newContextHTTP returns a contextHTTP that sends requests with client, and uses ctx
+// (context.Background if nil) and timeout (no timeout if zero.)
+func newContextHTTP(client *http.Client, ctx context.Context, timeout time.Duration) *contextHTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &contextHTTP{
+		client:  client,
+		ctx:     ctx,
+		timeout: timeout,
+	}
+}
+
+// Do sends req with the client's context and timeout.
+func (c *contextHTTP) Do(req *http.Request) (*http.Response, error) {
+	ctx := c.ctx
+	cancel := context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The timeout covers reading the body, so only release the context once the body is closed.
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// Get sends a GET request to url.
+func (c *contextHTTP) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+// Post sends a POST request with body to url.
+func (c *contextHTTP) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+// PostForm sends a POST request with the url-encoded form data to url.
+func (c *contextHTTP) PostForm(url string, data url.Values) (*http.Response, error) {
+	return c.Post(url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+// cancelBody is a response body that releases its request's context when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Middleware wraps an http.RoundTripper, e.g., to add tracing or logging to all requests
+// made by microstellar. Pass middleware to New with the "middleware" parameter.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// headerTransport is an http.RoundTripper that adds headers to all requests.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		if req.Header.Get(key) == "" {
+			req.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// newHTTPClient returns the *http.Client configured by the "http_client" and "middleware"
+// parameters. Middleware is applied in order (the first one sees requests first.) The client is
+// used for all requests, including those to federation servers and anchors, so it doesn't add
+// the "headers" parameter. See newHorizonHTTPClient.
+func newHTTPClient(params Params) *http.Client {
+	base, _ := params["http_client"].(*http.Client)
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	var middleware []Middleware
+	switch m := params["middleware"].(type) {
+	case Middleware:
+		middleware = []Middleware{m}
+	case func(http.RoundTripper) http.RoundTripper:
+		middleware = []Middleware{m}
+	case []Middleware:
+		middleware = m
+	}
+
+	if len(middleware) == 0 {
+		return base
+	}
+
+	transport := base.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+
+	client := *base
+	client.Transport = transport
+	return &client
+}
+
+// newHorizonHTTPClient returns the client from newHTTPClient, adding the "headers" parameter
+// (e.g., an API key) to every request before any middleware sees it. Use it only for requests
+// to Horizon, so the headers aren't leaked to third-party servers.
+func newHorizonHTTPClient(params Params) *http.Client {
+	client := newHTTPClient(params)
+
+	headers := http.Header{}
+	switch h := params["headers"].(type) {
+	case http.Header:
+		headers = h
+	case map[string]string:
+		for key, value := range h {
+			headers.Set(key, value)
+		}
+	}
+
+	if len(headers) == 0 {
+		return client
+	}
+
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	withHeaders := *client
+	withHeaders.Transport = &headerTransport{next: transport, headers: headers}
+	return &withHeaders
+}
+
+// httpClient returns the HTTP client for requests made on behalf of a call with options. It
+// uses the context set with Options.WithContext, and the "timeout", "http_client", and
+// "middleware" parameters passed to New. It doesn't send the "headers" parameter, which is only
+// for Horizon.
+func (ms *MicroStellar) httpClient(options []*Options) *contextHTTP {
+	var ctx context.Context
+	if len(options) > 0 && options[0] != nil {
+		ctx = options[0].ctx
+	}
+
+	return newContextHTTP(newHTTPClient(ms.params), ctx, durationParam(ms.params, "timeout", 0))
+}
+
+// queryTx returns a new Tx whose client uses the context in options. Use it for
+// queries (which shouldn't touch the multi-op transaction started with Start.)
+func (ms *MicroStellar) queryTx(options []*Options) *Tx {
+	tx := NewTx(ms.networkName, ms.params)
+	if len(options) > 0 && options[0] != nil {
+		tx.setContext(options[0].ctx)
+	}
+
+	return tx
+}
@@ -0,0 +1,164 @@
+package microstellar
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextHTTP(t *testing.T) {
+	server := newFakeHorizon(nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/order_book" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	if _, err := ms.LoadAccount(testAddress); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ms.LoadAccount(testAddress, Opts().WithContext(ctx)); err == nil {
+		t.Errorf("LoadAccount with cancelled context should fail")
+	}
+
+	client := newContextHTTP(nil, nil, 50*time.Millisecond)
+	start := time.Now()
+	if _, err := client.Get(server.URL + "/order_book"); err == nil {
+		t.Errorf("slow request should time out")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout not applied, request took %v", elapsed)
+	}
+
+	ms = New("custom", Params{"url": server.URL, "passphrase": "test", "timeout": 50 * time.Millisecond})
+	if _, err := ms.LoadOrderBook(NativeAsset, NewAsset("USD", testAddress, Credit4Type)); err == nil {
+		t.Errorf("LoadOrderBook should time out")
+	}
+}
+
+func TestHTTPClientParams(t *testing.T) {
+	var gotKey, gotTrace string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Api-Key")
+		gotTrace = r.Header.Get("X-Trace")
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1"}`, testAddress)
+	}))
+	defer server.Close()
+
+	traced := 0
+	tracer := Middleware(func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			traced++
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Trace", "on")
+			return next.RoundTrip(req)
+		})
+	})
+
+	ms := New("custom", Params{
+		"url":         server.URL,
+		"passphrase":  "test",
+		"http_client": &http.Client{Timeout: time.Second},
+		"headers":     map[string]string{"X-Api-Key": "secret"},
+		"middleware":  tracer,
+	})
+
+	if _, err := ms.LoadAccount(testAddress); err != nil {
+		t.Fatalf("LoadAccount: %v", err)
+	}
+
+	if gotKey != "secret" || gotTrace != "on" || traced != 1 {
+		t.Errorf("headers or middleware not applied: key=%q trace=%q traced=%d", gotKey, gotTrace, traced)
+	}
+
+	// Other hosts (federation servers, anchors, home domains) get the middleware, but not the
+	// Horizon headers.
+	var otherKey string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherKey = r.Header.Get("X-Api-Key")
+	}))
+	defer other.Close()
+
+	resp, err := ms.httpClient(nil).Get(other.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+
+	if traced != 2 {
+		t.Errorf("non-horizon requests should use the configured client: traced=%d", traced)
+	}
+
+	if otherKey != "" {
+		t.Errorf("non-horizon hosts should not get the horizon headers, got X-Api-Key=%q", otherKey)
+	}
+}
+
+func TestWatchHTTPClientParams(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 1000\nevent: open\ndata: \"hello\"\n\n")
+		fmt.Fprint(w, ": keepalive\n")
+		fmt.Fprint(w, "id: 42\ndata: {\"id\": \"ledger-1\",\ndata: \"paging_token\": \"42\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{
+		"url":         server.URL,
+		"passphrase":  "test",
+		"http_client": &http.Client{Timeout: 50 * time.Millisecond},
+		"headers":     map[string]string{"X-Api-Key": "secret"},
+	})
+
+	watcher, err := ms.WatchLedgers(Opts().WithCursor("now"))
+	if err != nil {
+		t.Fatalf("WatchLedgers: %v", err)
+	}
+	defer watcher.Done()
+
+	select {
+	case ledger := <-watcher.Ch:
+		if ledger.ID != "ledger-1" {
+			t.Errorf("wrong ledger: %+v", ledger)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no ledger received, stream error: %v", *watcher.Err)
+	}
+
+	r := <-requests
+	if r.URL.Path != "/ledgers" || r.URL.Query().Get("cursor") != "now" {
+		t.Errorf("wrong stream request: %s", r.URL)
+	}
+
+	if r.Header.Get("X-Api-Key") != "secret" || r.Header.Get("Accept") != "text/event-stream" {
+		t.Errorf("stream request missing headers: %v", r.Header)
+	}
+
+	// The stream outlives the client's request timeout.
+	time.Sleep(100 * time.Millisecond)
+	if *watcher.Err != nil {
+		t.Errorf("stream should not time out: %v", *watcher.Err)
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
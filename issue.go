@@ -0,0 +1,252 @@
+package microstellar
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+)
+
+// DefaultIssueStartingBalance is the lumens that IssueAsset funds new accounts with, if
+// IssueSpec.StartingBalance is not set.
+const DefaultIssueStartingBalance = "5"
+
+// IssueSpec describes an asset issued by IssueAsset.
+type IssueSpec struct {
+	// Asset code, up to 12 characters.
+	Code string
+
+	// Account that funds new accounts and pays the fee. If empty, IssuerSeed pays the fee.
+	FunderSeed string
+
+	// Issuing and distribution accounts. If empty, new accounts are created and funded with
+	// StartingBalance lumens from FunderSeed.
+	IssuerSeed      string
+	DistributorSeed string
+	StartingBalance string
+
+	// Amount issued to the distributor, and the distributor's trust limit ("" for no limit.)
+	Amount string
+	Limit  string
+
+	// Home domain of the issuer, for stellar.toml discovery.
+	HomeDomain string
+
+	// Issuer flags. If AuthRequired is set, the issuer authorizes the distributor's trustline.
+	AuthRequired  bool
+	AuthRevocable bool
+
+	// FixedSupply locks the issuer (by setting its master weight to 0) after issuing Amount, so
+	// that no more can be issued. IssueAsset fails if an existing issuer has other signers, since
+	// they could still issue.
+	FixedSupply bool
+}
+
+// IssueResult is returned by IssueAsset.
+type IssueResult struct {
+	Asset       *Asset   `json:"asset"`
+	Issuer      *KeyPair `json:"issuer"`
+	Distributor *KeyPair `json:"distributor"`
+	TxHash      string   `json:"tx_hash"`
+}
+
+// issueKeyPair returns the key pair for seed, or a new key pair if seed is empty.
+func (ms *MicroStellar) issueKeyPair(seed string) (*KeyPair, bool, error) {
+	if seed == "" {
+		pair, err := ms.CreateKeyPair()
+		return pair, true, err
+	}
+
+	if err := ValidSeed(seed); err != nil {
+		return nil, false, err
+	}
+
+	return &KeyPair{Seed: seed, Address: toAddress(seed)}, false, nil
+}
+
+// checkIssuerSigners returns an error if the account at address has signers other than its
+// master key, which would keep it unlocked after its master weight is set to 0.
+func (ms *MicroStellar) checkIssuerSigners(address string, opts *Options) error {
+	if ms.fake {
+		return nil
+	}
+
+	account, err := ms.LoadAccount(address, opts)
+	if err != nil {
+		return errors.Wrap(err, "can't load issuer")
+	}
+
+	for _, signer := range account.Signers {
+		key := signer.PublicKey
+		if key == "" {
+			key = signer.Key
+		}
+
+		if key != address && signer.Weight > 0 {
+			return errors.Errorf("issuer %s has another signer: %s", address, key)
+		}
+	}
+
+	return nil
+}
+
+// IssueAsset issues a new asset in a single multi-op transaction: it creates the issuer and
+// distributor (unless their seeds are set), sets the issuer's flags and home domain, creates
+// the distributor's trustline (and authorizes it), issues Amount to the distributor, and, for
+// fixed supply assets, locks the issuer. Either all of it happens or none of it does.
+//
+//   result, err := ms.IssueAsset(microstellar.IssueSpec{
+//       Code:        "USD",
+//       FunderSeed:  "SCSMBQYTXKZYY7CLVT6NPPYWVDQYDOQ6BB3QND4OIXC7762JYJYZ3RMK",
+//       Amount:      "1000000",
+//       HomeDomain:  "example.com",
+//       FixedSupply: true,
+//   })
+//
+//   log.Printf("issued %s, distributor seed: %s", result.Asset.Code, result.Distributor.Seed)
+//
+// Options (e.g., memos and fees) apply to the transaction. Keep the returned seeds safe: they're
+// the only copy of new accounts' keys.
+func (ms *MicroStellar) IssueAsset(spec IssueSpec, options ...*Options) (*IssueResult, error) {
+	if spec.Code == "" || len(spec.Code) > 12 {
+		return nil, ms.errorf("can't issue asset: invalid code: %q", spec.Code)
+	}
+
+	if _, err := ParseAmount(spec.Amount); err != nil {
+		return nil, ms.wrapf(err, "can't issue asset: invalid amount")
+	}
+
+	issuer, newIssuer, err := ms.issueKeyPair(spec.IssuerSeed)
+	if err != nil {
+		return nil, ms.wrapf(err, "can't issue asset: invalid issuer")
+	}
+
+	distributor, newDistributor, err := ms.issueKeyPair(spec.DistributorSeed)
+	if err != nil {
+		return nil, ms.wrapf(err, "can't issue asset: invalid distributor")
+	}
+
+	if issuer.Address == distributor.Address {
+		return nil, ms.errorf("can't issue asset: issuer and distributor must be different accounts")
+	}
+
+	source := spec.FunderSeed
+	if source == "" {
+		if newIssuer || newDistributor {
+			return nil, ms.errorf("can't issue asset: FunderSeed is required to create accounts")
+		}
+		source = issuer.Seed
+	} else if err := ValidSeed(source); err != nil {
+		return nil, ms.wrapf(err, "can't issue asset: invalid funder")
+	}
+
+	startingBalance := spec.StartingBalance
+	if startingBalance == "" {
+		startingBalance = DefaultIssueStartingBalance
+	}
+
+	opts := *mergeOptions(options)
+	if opts.isMultiOp {
+		return nil, ms.errorf("can't issue asset inside a multi-op transaction")
+	}
+
+	if spec.FixedSupply && !newIssuer {
+		if err := ms.checkIssuerSigners(issuer.Address, &opts); err != nil {
+			return nil, ms.wrapf(err, "can't issue fixed supply asset")
+		}
+	}
+
+	// Sign with every account that sources an operation, once each.
+	opts.signerSeeds = append([]string{}, opts.signerSeeds...)
+	for _, seed := range []string{source, issuer.Seed, distributor.Seed} {
+		signed := false
+		for _, signer := range opts.signerSeeds {
+			signed = signed || signer == seed
+		}
+
+		if !signed {
+			opts.signerSeeds = append(opts.signerSeeds, seed)
+		}
+	}
+
+	asset := NewCreditAsset(spec.Code, issuer.Address)
+
+	// Name each operation after the method that would queue it on its own, so that
+	// TxError.FailedMethod tells which one failed.
+	ops := []build.TransactionMutator{}
+	methods := []string{}
+	add := func(method string, op build.TransactionMutator) {
+		ops = append(ops, op)
+		methods = append(methods, method)
+	}
+
+	fund := func(pair *KeyPair) {
+		add("FundAccount", build.CreateAccount(
+			sourceAccount(source),
+			build.Destination{AddressOrSeed: pair.Address},
+			build.NativeAmount{Amount: startingBalance}))
+	}
+
+	if newIssuer {
+		fund(issuer)
+	}
+
+	if newDistributor {
+		fund(distributor)
+	}
+
+	var flags AccountFlags
+	if spec.AuthRequired {
+		flags |= FlagAuthRequired
+	}
+
+	if spec.AuthRevocable {
+		flags |= FlagAuthRevocable
+	}
+
+	if flags != FlagsNone {
+		add("SetFlags", build.SetOptions(sourceAccount(issuer.Address), build.SetFlag(int32(flags))))
+	}
+
+	if spec.HomeDomain != "" {
+		add("SetHomeDomain", build.SetOptions(sourceAccount(issuer.Address), build.HomeDomain(spec.HomeDomain)))
+	}
+
+	trustOptions := []interface{}{sourceAccount(distributor.Address)}
+	if spec.Limit != "" {
+		trustOptions = append(trustOptions, build.Limit(spec.Limit))
+	}
+
+	add("CreateTrustLine", build.Trust(asset.Code, asset.Issuer, trustOptions...))
+
+	if spec.AuthRequired {
+		add("AllowTrust", build.AllowTrust(
+			sourceAccount(issuer.Address),
+			build.Trustor{Address: distributor.Address},
+			build.AllowTrustAsset{Code: asset.Code},
+			build.Authorize{Value: true}))
+	}
+
+	add("Pay", build.Payment(
+		sourceAccount(issuer.Address),
+		build.Destination{AddressOrSeed: distributor.Address},
+		build.CreditAmount{Code: asset.Code, Issuer: asset.Issuer, Amount: spec.Amount}))
+
+	if spec.FixedSupply {
+		add("SetMasterWeight", build.SetOptions(sourceAccount(issuer.Address), build.MasterWeight(0)))
+	}
+
+	ms.Start(source, &opts)
+	tx := ms.getTx()
+	for i, op := range ops {
+		if err := tx.buildOp(methods[i], sourceAccount(source), op); err != nil {
+			ms.tx = nil
+			return nil, ms.wrapf(err, "can't issue asset")
+		}
+	}
+
+	if err := ms.Submit(); err != nil {
+		return nil, ms.wrapf(err, "can't issue asset")
+	}
+
+	result := &IssueResult{Asset: asset, Issuer: issuer, Distributor: distributor, TxHash: ms.Response().Hash}
+	return result, ms.success()
+}
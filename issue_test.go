@@ -0,0 +1,109 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestIssueAsset(t *testing.T) {
+	var envelope xdr.TransactionEnvelope
+	failTrust := false
+	issuer := func(address string) (string, bool) {
+		return fmt.Sprintf(`"signers": [{"public_key": "%s", "weight": 1},
+			{"public_key": "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ", "weight": 1}]`, address), address == testAddress
+	}
+
+	server := newFakeHorizon(issuer, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			if failTrust {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status": 400, "extras": {"result_codes": {"transaction": "tx_failed",
+					"operations": ["op_success", "op_success", "op_low_reserve", "op_success", "op_success"]}}}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"hash": "issued", "ledger": 2}`)
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	result, err := ms.IssueAsset(IssueSpec{
+		Code:         "MOOLAH",
+		FunderSeed:   testSeed,
+		Amount:       "1000",
+		HomeDomain:   "example.com",
+		AuthRequired: true,
+		FixedSupply:  true,
+	})
+
+	if err != nil {
+		t.Fatalf("IssueAsset failed: %v", err)
+	}
+
+	if result.TxHash != "issued" || result.Asset.Type != Credit12Type || result.Asset.Issuer != result.Issuer.Address {
+		t.Errorf("bad result: %+v", result)
+	}
+
+	want := []xdr.OperationType{
+		xdr.OperationTypeCreateAccount,
+		xdr.OperationTypeCreateAccount,
+		xdr.OperationTypeSetOptions,
+		xdr.OperationTypeSetOptions,
+		xdr.OperationTypeChangeTrust,
+		xdr.OperationTypeAllowTrust,
+		xdr.OperationTypePayment,
+		xdr.OperationTypeSetOptions,
+	}
+
+	ops := envelope.Tx.Operations
+	if len(ops) != len(want) {
+		t.Fatalf("want %d operations, got %d", len(want), len(ops))
+	}
+
+	for i, op := range ops {
+		if op.Body.Type != want[i] {
+			t.Errorf("operation %d: want %v, got %v", i, want[i], op.Body.Type)
+		}
+	}
+
+	if source := ops[4].SourceAccount.Address(); source != result.Distributor.Address {
+		t.Errorf("trustline should be sourced by the distributor, got %s", source)
+	}
+
+	if weight := ops[7].Body.MustSetOptionsOp().MasterWeight; weight == nil || *weight != 0 {
+		t.Errorf("fixed supply should lock the issuer")
+	}
+
+	// The funder, issuer, and distributor all sign.
+	if len(envelope.Signatures) != 3 {
+		t.Errorf("want 3 signatures, got %d", len(envelope.Signatures))
+	}
+
+	// Failed operations are named.
+	failTrust = true
+	_, err = ms.IssueAsset(IssueSpec{Code: "USD", FunderSeed: testSeed, Amount: "10", FixedSupply: true})
+	if txErr := AsTxError(err); txErr == nil || txErr.FailedMethod() != "CreateTrustLine" {
+		t.Errorf("want failed CreateTrustLine operation, got %v", err)
+	}
+
+	// An issuer with other signers can't be locked.
+	failTrust = false
+	_, err = ms.IssueAsset(IssueSpec{Code: "USD", IssuerSeed: testSeed, FunderSeed: testSeed, Amount: "10", FixedSupply: true})
+	if err == nil || !strings.Contains(err.Error(), "another signer") {
+		t.Errorf("want signer error for fixed supply, got %v", err)
+	}
+
+	if _, err := ms.IssueAsset(IssueSpec{Code: "USD", IssuerSeed: testSeed, DistributorSeed: testSeed, Amount: "10"}); err == nil {
+		t.Errorf("issuer and distributor should be different")
+	}
+
+	if _, err := ms.IssueAsset(IssueSpec{Code: "USD", Amount: "10"}); err == nil {
+		t.Errorf("new accounts should require a funder")
+	}
+}
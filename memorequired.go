@@ -0,0 +1,91 @@
+package microstellar
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/xdr"
+)
+
+// MemoRequiredDataKey is the data entry that marks an account as requiring a memo on incoming
+// payments (SEP-29). The entry's value is "1".
+const MemoRequiredDataKey = "config.memo_required"
+
+// MemoRequiredError is returned when a memo-less transaction pays an account that requires
+// a memo. Use errors.Cause(err) to get at it:
+//
+//   if _, ok := errors.Cause(err).(*microstellar.MemoRequiredError); ok {
+//       log.Print("please add a memo")
+//   }
+type MemoRequiredError struct {
+	Address string // the destination that requires a memo
+}
+
+// Error implements the error interface.
+func (e *MemoRequiredError) Error() string {
+	return fmt.Sprintf("destination account %s requires a memo", e.Address)
+}
+
+// RequiresMemo returns true if the account has the SEP-29 memo-required data entry set.
+func (account *Account) RequiresMemo() bool {
+	value, ok := account.GetData(MemoRequiredDataKey)
+	return ok && string(value) == "1"
+}
+
+// paymentDestinations returns the destinations of all payments, path payments, and account
+// merges in op order, without duplicates.
+func paymentDestinations(ops []xdr.Operation) []string {
+	seen := map[string]bool{}
+	destinations := []string{}
+
+	for _, op := range ops {
+		var destination xdr.AccountId
+		switch op.Body.Type {
+		case xdr.OperationTypePayment:
+			destination = op.Body.MustPaymentOp().Destination
+		case xdr.OperationTypePathPayment:
+			destination = op.Body.MustPathPaymentOp().Destination
+		case xdr.OperationTypeAccountMerge:
+			destination = op.Body.MustDestination()
+		default:
+			continue
+		}
+
+		address := destination.Address()
+		if !seen[address] {
+			seen[address] = true
+			destinations = append(destinations, address)
+		}
+	}
+
+	return destinations
+}
+
+// checkMemoRequired makes sure that the built transaction carries a memo if any of its payment
+// destinations requires one. Destinations that don't exist yet are skipped.
+func (tx *Tx) checkMemoRequired() error {
+	if tx.builder == nil || tx.builder.TX == nil {
+		return errors.Errorf("transaction not built")
+	}
+
+	if tx.builder.TX.Memo.Type != xdr.MemoTypeMemoNone {
+		return nil
+	}
+
+	for _, address := range paymentDestinations(tx.builder.TX.Operations) {
+		debugf("Tx.checkMemoRequired", "checking destination: %s", address)
+		ha, err := loadHorizonAccount(tx.client, address)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "can't check memo requirement: could not load account %s", address)
+		}
+
+		if newAccountFromHorizon(ha).RequiresMemo() {
+			return &MemoRequiredError{Address: address}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package microstellar
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+)
+
+func TestCheckMemoRequired(t *testing.T) {
+	const exchange = testAddress
+	const newAccount = "GAB6FX3WVKZZRUE64H77BRWLDIOIOR4MU27L3ATNVUYKXPX5GF22TOZO"
+
+	server := newFakeHorizon(func(address string) (string, bool) {
+		switch address {
+		case exchange:
+			return fmt.Sprintf(`"data": {"%s": "MQ=="}`, MemoRequiredDataKey), true
+		case newAccount:
+			return "", false
+		}
+
+		return "", true
+	}, nil)
+	defer server.Close()
+
+	sign := func(destination string, options *Options) error {
+		tx := NewTx("custom", Params{"url": server.URL, "passphrase": "test"})
+		tx.SetOptions(options)
+		payment := build.Payment(build.Destination{AddressOrSeed: destination}, build.NativeAmount{Amount: "1"})
+		if err := tx.Build(sourceAccount(testOtherSeed), payment); err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+		return tx.Sign(testOtherSeed)
+	}
+
+	err := sign(exchange, Opts())
+	if e, ok := errors.Cause(err).(*MemoRequiredError); !ok || e.Address != exchange {
+		t.Errorf("memo-less payment to exchange should fail with MemoRequiredError, got: %v", err)
+	}
+
+	// Unsigned envelopes are checked too.
+	err = sign(exchange, Opts().SkipSignatures())
+	if _, ok := errors.Cause(err).(*MemoRequiredError); !ok {
+		t.Errorf("unsigned memo-less payment to exchange should fail with MemoRequiredError, got: %v", err)
+	}
+
+	if err := sign(exchange, Opts().WithMemoID(7)); err != nil {
+		t.Errorf("payment with memo should succeed: %v", err)
+	}
+
+	if err := sign(exchange, Opts().SkipMemoRequiredCheck()); err != nil {
+		t.Errorf("skipped check should succeed: %v", err)
+	}
+
+	if err := sign("GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ", Opts()); err != nil {
+		t.Errorf("payment to regular account should succeed: %v", err)
+	}
+
+	if err := sign(newAccount, Opts()); err != nil {
+		t.Errorf("payment to missing account should succeed: %v", err)
+	}
+}
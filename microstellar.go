@@ -29,18 +29,18 @@
 //   ParseAmount("2.5") == int64(25000000)
 //   ToAmountString(1000000) == "1.000000"
 //
-// You can use ErrorString(...) to extract the Horizon error from a returned error.
+// For arithmetic, use the Amount type, which is backed by int64 stroops and detects overflows.
+//
+// You can use ErrorString(...) to extract the Horizon error from a returned error, and AsTxError(...)
+// or helpers like IsUnderfunded(...) to inspect the transaction and operation result codes.
 package microstellar
 
 import (
-	"net/http"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/stellar/go/build"
-	"github.com/stellar/go/clients/federation"
 	"github.com/stellar/go/clients/horizon"
-	"github.com/stellar/go/clients/stellartoml"
 	"github.com/stellar/go/keypair"
 	"github.com/stellar/go/network"
 	"github.com/stellar/go/xdr"
@@ -55,9 +55,14 @@ type MicroStellar struct {
 	tx          *Tx
 	lastTx      *Tx
 	lastErr     error
+
+	federationCache *ttlCache
+	accountCache    *ttlCache
+	orderBookCache  *ttlCache
 }
 
-// Error wraps underlying errors (e.g., horizon)
+// Error wraps underlying errors (e.g., horizon). Failed transactions are returned as
+// *TxError, see AsTxError.
 type Error struct {
 	HorizonError horizon.Error
 }
@@ -80,6 +85,39 @@ type Params map[string]interface{}
 //        "url": "https://my-horizon-server.com",
 //        "passphrase": "foobar"})
 //
+// To use several horizon instances, pass them in "urls" (a []string) instead of "url". Reads and
+// submissions go to a healthy instance, and fail over to the others when it's unreachable or
+// unavailable; Watch* streams reconnect to a healthy instance. See NewTx for the health check
+// parameters.
+//
+// Set the "timeout" parameter (a time.Duration) to limit the time taken by each network request. Use
+// Options.WithContext to cancel individual calls.
+//
+// All HTTP requests (to Horizon, federation servers, anchors, and friendbot) can be routed through
+// your own client with these parameters:
+//
+//    "http_client": an *http.Client to send requests with (defaults to http.DefaultClient)
+//    "headers":     an http.Header or map[string]string added to every Horizon request (e.g., API keys)
+//    "middleware":  a Middleware or []Middleware wrapping the client's transport (e.g., tracing)
+//
+// Streaming watchers (Watch*) go through the same client, headers, and middleware.
+//
+// To stay within Horizon's rate limits, set "rate_limit" (requests per second) and optionally
+// "rate_burst" (the largest burst of requests allowed.) The limiter also adapts to the
+// X-Ratelimit-* headers returned by Horizon, and waits and retries when Horizon responds with
+// 429 Too Many Requests. See RateLimiter to share a limiter across clients.
+//
+// Set "track_sequences" to true to allocate source account sequence numbers locally instead of
+// loading them from Horizon for every transaction. See SequenceTracker.
+//
+// Federated address lookups (Resolve) are cached for five minutes. Set the "federation_ttl"
+// parameter (a time.Duration) to change this, or to 0 to disable caching.
+//
+// To cache LoadAccount and LoadOrderBook results, set "account_ttl" and "orderbook_ttl" (both
+// time.Duration, disabled by default.) Cached accounts are dropped when this client submits a
+// transaction that touches them, cached order books are dropped on every submission, and both
+// caches are cleared whenever a WatchLedgers stream reports a new ledger.
+//
 // The microstellar client is not thread-safe, however you can create as many clients
 // as you need.
 func New(networkName string, params ...Params) *MicroStellar {
@@ -89,14 +127,56 @@ func New(networkName string, params ...Params) *MicroStellar {
 		p = params[0]
 	}
 
+	// Share one rate limiter, sequence tracker, and Horizon pool across all the transactions
+	// created by this client.
+	shared := Params{}
+	if _, ok := p["rate_limiter"]; !ok {
+		if limiter := rateLimiterParam(p); limiter != nil {
+			shared["rate_limiter"] = limiter
+		}
+	}
+
+	if _, ok := p["sequence_tracker"]; !ok {
+		if tracker := sequenceTrackerParam(p); tracker != nil {
+			shared["sequence_tracker"] = tracker
+		}
+	}
+
+	if _, ok := p["horizon_pool"]; !ok && networkName != "fake" {
+		if pool := horizonPoolParam(p); pool != nil {
+			shared["horizon_pool"] = pool
+		}
+	}
+
+	if len(shared) > 0 {
+		for key, value := range p {
+			shared[key] = value
+		}
+
+		p = shared
+	}
+
 	return &MicroStellar{
-		networkName: networkName,
-		params:      p,
-		fake:        networkName == "fake",
-		tx:          nil,
+		networkName:     networkName,
+		params:          p,
+		fake:            networkName == "fake",
+		tx:              nil,
+		federationCache: newTTLCache(durationParam(p, "federation_ttl", defaultFederationTTL)),
+		accountCache:    newTTLCache(durationParam(p, "account_ttl", 0)),
+		orderBookCache:  newTTLCache(durationParam(p, "orderbook_ttl", 0)),
 	}
 }
 
+// fork returns a new client with the same parameters, that shares ms's caches. Unlike ms itself,
+// the caches are thread-safe, so the fork can be used concurrently with ms.
+func (ms *MicroStellar) fork() *MicroStellar {
+	forked := New(ms.networkName, ms.params)
+	forked.federationCache = ms.federationCache
+	forked.accountCache = ms.accountCache
+	forked.orderBookCache = ms.orderBookCache
+	return forked
+}
+
 // NewFromSpec is a helper that creates a new MicroStellar client based on
 // spec, which is a semicolon-separated string.
 //
@@ -144,6 +224,7 @@ func (ms *MicroStellar) signAndSubmit(tx *Tx, signers ...string) error {
 	if !tx.isMultiOp {
 		tx.Sign(signers...)
 		tx.Submit()
+		ms.invalidateTx(tx.builtTx())
 	}
 
 	// Save last tx to keep response and error
@@ -222,6 +303,7 @@ func (ms *MicroStellar) Submit() error {
 
 	ms.tx.Sign()
 	ms.tx.Submit()
+	ms.invalidateTx(ms.tx.builtTx())
 
 	// Save last tx to keep response and error
 	ms.lastTx = tx
@@ -276,12 +358,13 @@ func (ms *MicroStellar) FundAccount(sourceSeed string, addressOrSeed string, amo
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), payment)
+	tx.buildOp("FundAccount", sourceAccount(sourceSeed), payment)
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
-// LoadAccount loads the account information for the given address.
-func (ms *MicroStellar) LoadAccount(address string) (*Account, error) {
+// LoadAccount loads the account information for the given address. Use Options.WithContext
+// to cancel the request. If the "account_ttl" parameter is set, results are cached (see New.)
+func (ms *MicroStellar) LoadAccount(address string, options ...*Options) (*Account, error) {
 	if !ValidAddressOrSeed(address) {
 		return nil, ms.errorf("can't load account: invalid address or seed: %v", address)
 	}
@@ -290,38 +373,38 @@ func (ms *MicroStellar) LoadAccount(address string) (*Account, error) {
 		return newAccount(), ms.success()
 	}
 
+	key := toAddress(address)
+	if cached, ok := ms.accountCache.get(key); ok {
+		debugf("LoadAccount", "using cached account: %s", address)
+		return copyAccount(cached.(*Account)), ms.success()
+	}
+
 	debugf("LoadAccount", "loading account: %s", address)
-	tx := NewTx(ms.networkName, ms.params)
-	account, err := tx.GetClient().LoadAccount(address)
+	tx := ms.queryTx(options)
+	account, err := loadHorizonAccount(tx.GetClient(), address)
 
 	if err != nil {
 		return nil, ms.wrapf(err, "could not load account")
 	}
 
-	return newAccountFromHorizon(account), ms.success()
+	result := newAccountFromHorizon(account)
+	ms.accountCache.set(key, copyAccount(result))
+	return result, ms.success()
 }
 
 // Resolve looks up a federated address
-func (ms *MicroStellar) Resolve(address string) (string, error) {
+func (ms *MicroStellar) Resolve(address string, options ...*Options) (string, error) {
 	debugf("Resolve", "looking up: %s", address)
 	if !strings.Contains(address, "*") {
 		return "", ms.errorf("not a fedaration address: %s", address)
 	}
 
-	// Create a new federation client and lookup address
-	var fedClient = &federation.Client{
-		HTTP:        http.DefaultClient,
-		Horizon:     NewTx(ms.networkName, ms.params).GetClient(),
-		StellarTOML: stellartoml.DefaultClient,
-	}
-
-	resp, err := fedClient.LookupByAddress(address)
-
+	record, err := ms.lookupAddress(address, options)
 	if err != nil {
 		return "", ms.wrapf(err, "resolve error")
 	}
 
-	return resp.AccountID, ms.success()
+	return record.AccountID, ms.success()
 }
 
 // PayNative makes a native asset payment of amount from source to target.
@@ -329,7 +412,9 @@ func (ms *MicroStellar) PayNative(sourceSeed string, targetAddress string, amoun
 	return ms.Pay(sourceSeed, targetAddress, amount, NativeAsset, options...)
 }
 
-// Pay lets you make payments with credit assets.
+// Pay lets you make payments with credit assets. targetAddress can be a federated address (e.g.,
+// "mo*example.com"), in which case the memo required by the federation server is added to the
+// transaction. Pay fails if options carry a different memo.
 //
 //   USD := microstellar.NewAsset("USD", "ISSUERSEED", microstellar.Credit4Type)
 //   ms.Pay("source_seed", "target_address", "3", USD, microstellar.Opts().WithMemoText("for shelter"))
@@ -350,6 +435,10 @@ func (ms *MicroStellar) PayNative(sourceSeed string, targetAddress string, amoun
 //
 //   ms.Pay("marys_seed", "bobs_address", "2000", INR,
 //       microstellar.Opts().WithAsset(XLM, "20").Through(USD, EUR).FindPathFrom("marys_address"))
+//
+// Before submitting, Pay checks that the source account can afford the payment (and fee) without
+// dipping into its minimum balance or offer liabilities, and returns an *InsufficientBalanceError
+// if not. Use Opts().SkipBalanceCheck() to skip the check.
 func (ms *MicroStellar) Pay(sourceAddressOrSeed string, targetAddress string, amount string, asset *Asset, options ...*Options) error {
 	if err := asset.Validate(); err != nil {
 		return ms.wrapf(err, "can't pay")
@@ -359,10 +448,19 @@ func (ms *MicroStellar) Pay(sourceAddressOrSeed string, targetAddress string, am
 		return ms.errorf("can't pay: invalid source address or seed: %s", sourceAddressOrSeed)
 	}
 
+	targetAddress, options, err := ms.resolveTarget(targetAddress, options)
+	if err != nil {
+		return ms.wrapf(err, "can't pay")
+	}
+
 	if !ValidAddressOrSeed(targetAddress) {
 		return ms.errorf("can't pay: invalid address: %v", targetAddress)
 	}
 
+	if err := ms.checkPayment(sourceAddressOrSeed, amount, asset, options); err != nil {
+		return ms.wrapf(err, "can't pay")
+	}
+
 	paymentMuts := []interface{}{
 		build.Destination{AddressOrSeed: targetAddress},
 	}
@@ -415,7 +513,7 @@ func (ms *MicroStellar) Pay(sourceAddressOrSeed string, targetAddress string, am
 		}
 	}
 
-	tx.Build(sourceAccount(sourceAddressOrSeed), build.Payment(paymentMuts...))
+	tx.buildOp("Pay", sourceAccount(sourceAddressOrSeed), build.Payment(paymentMuts...))
 	return ms.signAndSubmit(tx, sourceAddressOrSeed)
 }
 
@@ -437,9 +535,9 @@ func (ms *MicroStellar) CreateTrustLine(sourceSeed string, asset *Asset, limit s
 	}
 
 	if limit == "" {
-		tx.Build(sourceAccount(sourceSeed), build.Trust(asset.Code, asset.Issuer))
+		tx.buildOp("CreateTrustLine", sourceAccount(sourceSeed), build.Trust(asset.Code, asset.Issuer))
 	} else {
-		tx.Build(sourceAccount(sourceSeed), build.Trust(asset.Code, asset.Issuer, build.Limit(limit)))
+		tx.buildOp("CreateTrustLine", sourceAccount(sourceSeed), build.Trust(asset.Code, asset.Issuer, build.Limit(limit)))
 	}
 
 	return ms.signAndSubmit(tx, sourceSeed)
@@ -461,7 +559,7 @@ func (ms *MicroStellar) RemoveTrustLine(sourceSeed string, asset *Asset, options
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.RemoveTrust(asset.Code, asset.Issuer))
+	tx.buildOp("RemoveTrustLine", sourceAccount(sourceSeed), build.RemoveTrust(asset.Code, asset.Issuer))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -483,7 +581,7 @@ func (ms *MicroStellar) AllowTrust(sourceSeed string, address string, assetCode
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.AllowTrust(
+	tx.buildOp("AllowTrust", sourceAccount(sourceSeed), build.AllowTrust(
 		build.Trustor{Address: address},
 		build.AllowTrustAsset{Code: assetCode},
 		build.Authorize{Value: authorized}))
@@ -503,7 +601,7 @@ func (ms *MicroStellar) SetMasterWeight(sourceSeed string, weight uint32, option
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.MasterWeight(weight))
+	tx.buildOp("SetMasterWeight", sourceAccount(sourceSeed), build.MasterWeight(weight))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -539,7 +637,7 @@ func (ms *MicroStellar) SetFlags(sourceSeed string, flags AccountFlags, options
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.SetFlag(int32(flags)))
+	tx.buildOp("SetFlags", sourceAccount(sourceSeed), build.SetFlag(int32(flags)))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -555,7 +653,7 @@ func (ms *MicroStellar) ClearFlags(sourceSeed string, flags AccountFlags, option
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.ClearFlag(int32(flags)))
+	tx.buildOp("ClearFlags", sourceAccount(sourceSeed), build.ClearFlag(int32(flags)))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -571,7 +669,7 @@ func (ms *MicroStellar) SetHomeDomain(sourceSeed string, domain string, options
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.HomeDomain(domain))
+	tx.buildOp("SetHomeDomain", sourceAccount(sourceSeed), build.HomeDomain(domain))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -591,7 +689,7 @@ func (ms *MicroStellar) AddSigner(sourceSeed string, signerAddress string, signe
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.AddSigner(signerAddress, signerWeight))
+	tx.buildOp("AddSigner", sourceAccount(sourceSeed), build.AddSigner(signerAddress, signerWeight))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -611,7 +709,7 @@ func (ms *MicroStellar) RemoveSigner(sourceSeed string, signerAddress string, op
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.RemoveSigner(signerAddress))
+	tx.buildOp("RemoveSigner", sourceAccount(sourceSeed), build.RemoveSigner(signerAddress))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -627,7 +725,7 @@ func (ms *MicroStellar) SetThresholds(sourceSeed string, low, medium, high uint3
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.SetThresholds(low, medium, high))
+	tx.buildOp("SetThresholds", sourceAccount(sourceSeed), build.SetThresholds(low, medium, high))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -656,7 +754,7 @@ func (ms *MicroStellar) SetData(sourceSeed string, key string, val []byte, optio
 		return ms.errorf("data value must be under 64 bytes: %s", string(val))
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.SetData(key, val))
+	tx.buildOp("SetData", sourceAccount(sourceSeed), build.SetData(key, val))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -676,7 +774,7 @@ func (ms *MicroStellar) ClearData(sourceSeed string, key string, options ...*Opt
 		return ms.errorf("data key must be under 64 bytes: %s", key)
 	}
 
-	tx.Build(sourceAccount(sourceSeed), build.ClearData(key))
+	tx.buildOp("ClearData", sourceAccount(sourceSeed), build.ClearData(key))
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -721,9 +819,16 @@ func (ms *MicroStellar) SignTransaction(b64Tx string, seeds ...string) (string,
 }
 
 // SubmitTransaction submits a base64-encoded transaction envelope to the Stellar network
-func (ms *MicroStellar) SubmitTransaction(b64Tx string) (*TxResponse, error) {
-	tx := ms.getTx()
+func (ms *MicroStellar) SubmitTransaction(b64Tx string, options ...*Options) (*TxResponse, error) {
+	tx := ms.queryTx(options)
 	resp, err := tx.GetClient().SubmitTransaction(b64Tx)
 	txResponse := TxResponse(resp)
+
+	var envelope xdr.TransactionEnvelope
+	if xdr.SafeUnmarshalBase64(b64Tx, &envelope) == nil {
+		ms.invalidateTx(&envelope.Tx)
+	} else {
+		ms.invalidateTx(nil)
+	}
 	return &txResponse, ms.err(err)
 }
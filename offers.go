@@ -37,6 +37,9 @@ type OfferParams struct {
 	// How much you're willing to pay (in BuyAsset units) per unit of SellAsset.
 	Price string
 
+	// The exact price, if set, is used instead of Price.
+	PriceR *Price
+
 	// How many units of SellAsset are you selling?
 	SellAmount string
 
@@ -126,7 +129,7 @@ func (ms *MicroStellar) LoadOffers(address string, options ...*Options) ([]Offer
 		return []Offer{}, ms.success()
 	}
 
-	tx := ms.getTx()
+	tx := ms.queryTx(options)
 	horizonOffers, err := tx.GetClient().LoadAccountOffers(address, params...)
 
 	if err != nil {
@@ -155,10 +158,23 @@ func (ms *MicroStellar) ManageOffer(sourceSeed string, params *OfferParams, opti
 		return ms.wrapf(err, "ManageOffer")
 	}
 
+	var price Price
+	if params.PriceR != nil {
+		price = *params.PriceR
+		if err := price.Validate(); err != nil {
+			return ms.wrapf(err, "ManageOffer")
+		}
+	} else {
+		var err error
+		if price, err = PriceFromString(params.Price); err != nil {
+			return ms.wrapf(err, "ManageOffer")
+		}
+	}
+
 	rate := build.Rate{
 		Selling: params.SellAsset.ToStellarAsset(),
 		Buying:  params.BuyAsset.ToStellarAsset(),
-		Price:   build.Price(params.Price),
+		Price:   build.Price(price.String()),
 	}
 
 	var offerID uint64
@@ -186,13 +202,16 @@ func (ms *MicroStellar) ManageOffer(sourceSeed string, params *OfferParams, opti
 		return ms.errorf("ManageOffer: bad OfferType: %v", params.OfferType)
 	}
 
+	// The decimal rate above may be inexact, so set the rational price.
+	builder.Mutate(price)
+
 	tx := ms.getTx()
 
 	if len(options) > 0 {
 		tx.SetOptions(options[0])
 	}
 
-	tx.Build(sourceAccount(sourceSeed), builder)
+	tx.buildOp("ManageOffer", sourceAccount(sourceSeed), builder)
 	return ms.signAndSubmit(tx, sourceSeed)
 }
 
@@ -244,7 +263,7 @@ func (ms *MicroStellar) DeleteOffer(sourceSeed string, offerID string, sellAsset
 // FindPaths finds payment paths between source and dest assets. Use Options.WithAsset
 // to filter the results by source asset and max spend.
 func (ms *MicroStellar) FindPaths(sourceAddress string, destAddress string, destAsset *Asset, destAmount string, options ...*Options) ([]Path, error) {
-	tx := ms.getTx()
+	tx := ms.queryTx(options)
 	client := tx.GetClient()
 	baseURL := strings.TrimRight(client.URL, "/") + "/paths"
 
@@ -268,6 +287,7 @@ func (ms *MicroStellar) FindPaths(sourceAddress string, destAddress string, dest
 	if err != nil {
 		return nil, ms.errorf("failed to query server: %v", err)
 	}
+	defer resp.Body.Close()
 
 	var pathResponse horizonPathResponse
 	bytes, _ := ioutil.ReadAll(resp.Body)
@@ -328,10 +348,12 @@ func (ms *MicroStellar) FindPaths(sourceAddress string, destAddress string, dest
 // HorizonOrderBook represents an a horzon order_book response.
 type horizonOrderBook struct {
 	Bids []struct {
+		PriceR Price  `json:"price_r"`
 		Price  string `json:"price"`
 		Amount string `json:"amount"`
 	} `json:"bids"`
 	Asks []struct {
+		PriceR Price  `json:"price_r"`
 		Price  string `json:"price"`
 		Amount string `json:"amount"`
 	} `json:"asks"`
@@ -341,6 +363,7 @@ type horizonOrderBook struct {
 
 // BidAsk represents a price and amount for a specific Bid or Ask.
 type BidAsk struct {
+	PriceR Price  `json:"price_r"`
 	Price  string `json:"price"`
 	Amount string `json:"amount"`
 }
@@ -354,9 +377,10 @@ type OrderBook struct {
 }
 
 // LoadOrderBook returns the current orderbook for all trades between sellAsset and buyAsset. Use
-// Opts().WithLimit(limit) to limit the number of entries returned.
+// Opts().WithLimit(limit) to limit the number of entries returned. If the "orderbook_ttl" parameter
+// is set, results are cached (see New.)
 func (ms *MicroStellar) LoadOrderBook(sellAsset *Asset, buyAsset *Asset, options ...*Options) (*OrderBook, error) {
-	tx := ms.getTx()
+	tx := ms.queryTx(options)
 	client := tx.GetClient()
 	baseURL := strings.TrimRight(client.URL, "/") + "/order_book"
 	opts := mergeOptions(options)
@@ -379,11 +403,17 @@ func (ms *MicroStellar) LoadOrderBook(sellAsset *Asset, buyAsset *Asset, options
 		return nil, ms.errorf("endpoint parse error: %v", err)
 	}
 
+	if cached, ok := ms.orderBookCache.get(query.Encode()); ok {
+		debugf("LoadOrderBook", "using cached order book: %s", endpoint)
+		return copyOrderBook(cached.(*OrderBook)), ms.success()
+	}
+
 	debugf("LoadOrderBook", "querying endpoint: %s", endpoint)
 	resp, err := client.HTTP.Get(endpoint)
 	if err != nil {
 		return nil, ms.errorf("failed to query server: %v", err)
 	}
+	defer resp.Body.Close()
 
 	var orderBook horizonOrderBook
 	bytes, _ := ioutil.ReadAll(resp.Body)
@@ -400,11 +430,12 @@ func (ms *MicroStellar) LoadOrderBook(sellAsset *Asset, buyAsset *Asset, options
 	}
 
 	for _, ask := range orderBook.Asks {
-		returnOrderBook.Asks = append(returnOrderBook.Asks, BidAsk{Price: ask.Price, Amount: ask.Amount})
+		returnOrderBook.Asks = append(returnOrderBook.Asks, BidAsk{PriceR: ask.PriceR, Price: ask.Price, Amount: ask.Amount})
 	}
 	for _, bid := range orderBook.Bids {
-		returnOrderBook.Bids = append(returnOrderBook.Bids, BidAsk{Price: bid.Price, Amount: bid.Amount})
+		returnOrderBook.Bids = append(returnOrderBook.Bids, BidAsk{PriceR: bid.PriceR, Price: bid.Price, Amount: bid.Amount})
 	}
 
+	ms.orderBookCache.set(query.Encode(), copyOrderBook(&returnOrderBook))
 	return &returnOrderBook, ms.success()
 }
@@ -2,7 +2,12 @@ package microstellar
 
 import (
 	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // SortOrder is used with WithSortOrder
@@ -59,8 +64,12 @@ type Options struct {
 	memoID   uint64   // additional memo ID
 	memoHash [32]byte // additional memo ID
 
-	skipSignatures bool
-	signerSeeds    []string
+	skipSignatures        bool
+	signerSeeds           []string
+	checkThresholds       bool
+	skipMemoRequiredCheck bool
+	skipBalanceCheck      bool
+	channelSeed           string
 
 	// Options for query methods (Watch*, Load*)
 	hasCursor      bool
@@ -81,6 +90,12 @@ type Options struct {
 	// for multi-op transactions
 	isMultiOp     bool
 	multiOpSource string
+
+	// For batch payments.
+	journal string
+
+	// For SEP-10 web authentication.
+	serverKey string
 }
 
 // NewOptions creates a new options structure for Tx.
@@ -148,14 +163,83 @@ func (o *Options) WithMemoReturn(hash [32]byte) *Options {
 	return o
 }
 
+// sameMemo returns true if o and other carry the same memo.
+func (o *Options) sameMemo(other *Options) bool {
+	if o.memoType != other.memoType {
+		return false
+	}
+
+	switch o.memoType {
+	case MemoText:
+		return o.memoText == other.memoText
+	case MemoID:
+		return o.memoID == other.memoID
+	case MemoHash, MemoReturn:
+		return o.memoHash == other.memoHash
+	}
+
+	return true
+}
+
+// setMemo sets the memo on the options from memoType ("text", "id", "hash", or "return") and
+// a string encoding of the memo. Hash memos are base64-encoded. This is the encoding used by
+// federation servers, anchors, and payment URIs.
+func (o *Options) setMemo(memoType string, memo string) error {
+	switch strings.TrimPrefix(strings.ToLower(memoType), "memo_") {
+	case "", "none":
+		return nil
+	case "text":
+		o.WithMemoText(memo)
+	case "id":
+		id, err := strconv.ParseUint(memo, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "bad memo ID: %s", memo)
+		}
+		o.WithMemoID(id)
+	case "hash", "return":
+		decoded, err := base64.StdEncoding.DecodeString(memo)
+		if err != nil || len(decoded) != 32 {
+			return errors.Errorf("bad memo hash (must be 32 bytes, base64-encoded): %s", memo)
+		}
+
+		var hash [32]byte
+		copy(hash[:], decoded)
+		if strings.HasSuffix(strings.ToLower(memoType), "return") {
+			o.WithMemoReturn(hash)
+		} else {
+			o.WithMemoHash(hash)
+		}
+	default:
+		return errors.Errorf("unsupported memo type: %s", memoType)
+	}
+
+	return nil
+}
+
 // WithSigner adds a signer to Payment. Used with all transactions.
 func (o *Options) WithSigner(signerSeed string) *Options {
 	o.signerSeeds = append(o.signerSeeds, signerSeed)
 	return o
 }
 
-// WithContext sets the context.Context for the connection. Used with
-// Watch* methods.
+// WithChannel makes channelSeed's account the source of the transaction, so that it pays the
+// fee and supplies the sequence number, while the operation keeps the source account passed to
+// the method. The transaction is signed with channelSeed in addition to the usual signers. Not
+// supported for multi-op transactions. See ChannelPool.
+func (o *Options) WithChannel(channelSeed string) *Options {
+	o.channelSeed = channelSeed
+	return o
+}
+
+// WithJournal sets the file in which BatchPay records pending and completed payments, so that an
+// interrupted batch can be resumed without paying anyone twice.
+func (o *Options) WithJournal(path string) *Options {
+	o.journal = path
+	return o
+}
+
+// WithContext sets the context.Context for the connection. Cancelling the context aborts
+// the call's network requests. Used with all methods that access the network.
 func (o *Options) WithContext(context context.Context) *Options {
 	o.ctx = context
 	return o
@@ -241,6 +325,36 @@ func (o *Options) SkipSignatures() *Options {
 	return o
 }
 
+// WithServerKey pins the expected signing key of the authentication server. Used with
+// SEP10Authenticate.
+func (o *Options) WithServerKey(address string) *Options {
+	o.serverKey = address
+	return o
+}
+
+// CheckThresholds makes Tx verify, before signing, that the signers carry enough weight to
+// meet the source accounts' thresholds for every queued operation. The accounts are loaded
+// from the network, and the transaction fails locally (without being submitted) if the
+// weight is insufficient. Used with all transactions.
+func (o *Options) CheckThresholds() *Options {
+	o.checkThresholds = true
+	return o
+}
+
+// SkipMemoRequiredCheck disables the SEP-29 check that refuses memo-less payments to accounts
+// that have the "config.memo_required" data entry set. Used with payment transactions.
+func (o *Options) SkipMemoRequiredCheck() *Options {
+	o.skipMemoRequiredCheck = true
+	return o
+}
+
+// SkipBalanceCheck disables Pay's check that the source account can afford the payment without
+// dipping into its minimum balance or offer liabilities.
+func (o *Options) SkipBalanceCheck() *Options {
+	o.skipBalanceCheck = true
+	return o
+}
+
 // WithTimeBounds attaches time bounds to the transaction. This means that the transaction
 // can only be submitted between min and max time (as determined by the ledger.)
 func (o *Options) WithTimeBounds(min time.Time, max time.Time) *Options {
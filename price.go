@@ -0,0 +1,126 @@
+package microstellar
+
+import (
+	"math/big"
+
+	"github.com/pkg/errors"
+	stellarprice "github.com/stellar/go/price"
+	"github.com/stellar/go/xdr"
+)
+
+// Price is an exact rational price on the DEX, i.e., N units of the buying asset per D units of
+// the selling asset. This is how prices are stored on the ledger, and how horizon returns them (as
+// "price_r".) Use Price instead of decimal strings to avoid rounding surprises.
+//
+//   p, err := microstellar.PriceFromString("0.25")  // 1/4
+//   p.Invert().String() == "4.0000000"
+//   cost, err := microstellar.MustAmount("10").MulPrice(p)
+type Price struct {
+	N int32 `json:"n"`
+	D int32 `json:"d"`
+}
+
+// NewPrice returns the price n/d.
+func NewPrice(n int32, d int32) Price {
+	return Price{N: n, D: d}
+}
+
+// PriceFromString returns the best rational approximation of the decimal price v, with the
+// numerator and denominator within int32 bounds.
+func PriceFromString(v string) (Price, error) {
+	p, err := stellarprice.Parse(v)
+	if err != nil {
+		return Price{}, errors.Wrapf(err, "invalid price: %s", v)
+	}
+
+	price := Price{N: int32(p.N), D: int32(p.D)}
+	return price, errors.Wrapf(price.Validate(), "invalid price: %s", v)
+}
+
+// MustPrice is the panicking version of PriceFromString, for use with constants.
+func MustPrice(v string) Price {
+	p, err := PriceFromString(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// Validate returns an error if the price can't be used in an offer.
+func (p Price) Validate() error {
+	if p.N <= 0 || p.D <= 0 {
+		return errors.Errorf("price must be positive: %d/%d", p.N, p.D)
+	}
+
+	return nil
+}
+
+// Invert returns the price from the other side of the trade, i.e., D/N. E.g., an offer selling XLM
+// for USD at 0.25 is an offer buying XLM with USD at 4.
+func (p Price) Invert() Price {
+	return Price{N: p.D, D: p.N}
+}
+
+// Cmp returns -1, 0, or 1 if p is less than, equal to, or greater than other.
+func (p Price) Cmp(other Price) int {
+	return p.rat().Cmp(other.rat())
+}
+
+// Equal returns true if p and other are the same price, e.g., 1/2 and 2/4.
+func (p Price) Equal(other Price) bool {
+	return p.Cmp(other) == 0
+}
+
+// String returns the price as a decimal string with seven decimal places, as horizon does.
+func (p Price) String() string {
+	if p.D == 0 {
+		return "0.0000000"
+	}
+
+	return p.rat().FloatString(AmountPrecision)
+}
+
+// ToXDR returns the price as an xdr.Price.
+func (p Price) ToXDR() xdr.Price {
+	return xdr.Price{N: xdr.Int32(p.N), D: xdr.Int32(p.D)}
+}
+
+// MutateManageOffer implements build.ManageOfferMutator, so the exact price is set on the offer.
+func (p Price) MutateManageOffer(o interface{}) error {
+	switch o := o.(type) {
+	case *xdr.ManageOfferOp:
+		o.Price = p.ToXDR()
+	case *xdr.CreatePassiveOfferOp:
+		o.Price = p.ToXDR()
+	default:
+		return errors.Errorf("unexpected operation type: %T", o)
+	}
+
+	return nil
+}
+
+func (p Price) rat() *big.Rat {
+	if p.D == 0 {
+		return new(big.Rat)
+	}
+
+	return big.NewRat(int64(p.N), int64(p.D))
+}
+
+// MulPrice returns the amount multiplied by price p, i.e., the cost in the buying asset of
+// selling the amount at p. The result is truncated to the nearest stroop.
+func (a Amount) MulPrice(p Price) (Amount, error) {
+	return a.Mul(int64(p.N), int64(p.D))
+}
+
+// DivPrice returns the amount divided by price p, i.e., how much of the selling asset an amount of
+// the buying asset is worth at p. The result is truncated to the nearest stroop.
+func (a Amount) DivPrice(p Price) (Amount, error) {
+	return a.Div(int64(p.N), int64(p.D))
+}
+
+// PriceValue returns the offer's exact price.
+func (o Offer) PriceValue() Price {
+	return Price{N: o.PriceR.N, D: o.PriceR.D}
+}
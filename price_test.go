@@ -0,0 +1,76 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestPrice(t *testing.T) {
+	p, err := PriceFromString("0.25")
+	if err != nil || p != NewPrice(1, 4) {
+		t.Errorf("bad price: %+v, %v", p, err)
+	}
+
+	if third := MustPrice("0.3333333"); third.String() != "0.3333333" {
+		t.Errorf("bad approximation: %+v", third)
+	}
+
+	if _, err := PriceFromString("0"); err == nil {
+		t.Errorf("zero prices should fail")
+	}
+
+	if inverted := p.Invert(); inverted != NewPrice(4, 1) || inverted.String() != "4.0000000" {
+		t.Errorf("bad inverted price: %+v", inverted)
+	}
+
+	if !p.Equal(NewPrice(2, 8)) || p.Cmp(NewPrice(1, 3)) != -1 || p.Invert().Cmp(p) != 1 {
+		t.Errorf("bad comparisons")
+	}
+
+	// 10 at 1/3 is exactly 3.3333333 after truncation.
+	cost, err := MustAmount("10").MulPrice(NewPrice(1, 3))
+	if err != nil || cost.String() != "3.3333333" {
+		t.Errorf("bad cost: %s, %v", cost, err)
+	}
+
+	worth, err := MustAmount("10").DivPrice(p)
+	if err != nil || worth.String() != "40.0000000" {
+		t.Errorf("bad worth: %s, %v", worth, err)
+	}
+}
+
+func TestManageOfferPrice(t *testing.T) {
+	var price xdr.Price
+	server := newFakeHorizon(nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			var envelope xdr.TransactionEnvelope
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			price = envelope.Tx.Operations[0].Body.ManageOfferOp.Price
+			fmt.Fprint(w, `{"hash": "hash", "ledger": 2}`)
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	USD := NewAsset("USD", testAddress, Credit4Type)
+
+	exact := NewPrice(1, 3)
+	err := ms.ManageOffer(testOtherSeed, &OfferParams{
+		OfferType:  OfferCreate,
+		SellAsset:  NativeAsset,
+		BuyAsset:   USD,
+		PriceR:     &exact,
+		SellAmount: "10",
+	})
+
+	if err != nil || price.N != 1 || price.D != 3 {
+		t.Errorf("want exact price 1/3, got %d/%d (%v)", price.N, price.D, err)
+	}
+
+	if err := ms.CreateOffer(testOtherSeed, NativeAsset, USD, "bad", "10"); err == nil {
+		t.Errorf("bad prices should fail")
+	}
+}
@@ -0,0 +1,244 @@
+package microstellar
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitRetries is the number of times a request rejected with 429 Too Many Requests is
+// retried before the response is returned to the caller.
+const maxRateLimitRetries = 3
+
+// defaultRetryAfter is how long to wait after a 429 response without a Retry-After header.
+const defaultRetryAfter = time.Second
+
+// RateLimiter is a token-bucket rate limiter for Horizon requests. It allows bursts of up to
+// burst requests, refilled at rate requests per second, and pauses all requests when Horizon
+// reports (via the X-Ratelimit-* headers, or a 429 response) that the limit is exhausted.
+//
+// A MicroStellar client creates one from the "rate_limit" and "rate_burst" parameters, and
+// shares it across all its requests. To share a limiter across clients, create it with
+// NewRateLimiter and pass it in the "rate_limiter" parameter.
+//
+//   limiter := microstellar.NewRateLimiter(10, 20)
+//   ms1 := microstellar.New("public", microstellar.Params{"rate_limiter": limiter})
+//   ms2 := microstellar.New("public", microstellar.Params{"rate_limiter": limiter})
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64   // tokens added per second
+	burst       float64   // maximum tokens
+	tokens      float64   // available tokens
+	last        time.Time // time tokens was last updated
+	pausedUntil time.Time // no requests are allowed until this time
+	now         func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter that allows rate requests per second, with bursts of
+// up to burst requests. If burst is less than 1, it defaults to rate (or 1, if rate < 1.)
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// refill adds tokens accrued since the last update. Must be called with l.mu held.
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+
+	l.last = now
+}
+
+// reserve takes a token if one is available, and returns zero. Otherwise it returns how long to
+// wait before trying again.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	if l.rate <= 0 {
+		return defaultRetryAfter
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Wait blocks until a request is allowed, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return nil
+		}
+
+		debugf("RateLimiter.Wait", "rate limited, waiting %v", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pause blocks all requests for d.
+func (l *RateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := l.now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// update adapts the limiter to the rate limit state reported in Horizon's response headers. If
+// Horizon has fewer requests remaining than the limiter has tokens, the tokens are reduced to
+// match, and if none remain, requests are paused until the limit resets.
+func (l *RateLimiter) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.refill(l.now())
+	if float64(remaining) < l.tokens {
+		l.tokens = float64(remaining)
+	}
+	l.mu.Unlock()
+
+	if remaining == 0 {
+		reset, err := strconv.Atoi(header.Get("X-Ratelimit-Reset"))
+		if err != nil {
+			reset = 1
+		}
+
+		l.pause(time.Duration(reset) * time.Second)
+	}
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a 429 response, which
+// may be in seconds or an HTTP date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+
+	return defaultRetryAfter
+}
+
+// rateLimitTransport is an http.RoundTripper that sends requests through a RateLimiter, and
+// retries requests rejected with 429 Too Many Requests after the requested delay.
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		outgoing := req
+		if attempt > 0 {
+			outgoing = req.Clone(req.Context())
+			if req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+
+				outgoing.Body = body
+			}
+		}
+
+		resp, err := t.next.RoundTrip(outgoing)
+		if err != nil {
+			return nil, err
+		}
+
+		t.limiter.update(resp.Header)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		// Only retry if there are attempts left, and the body can be replayed.
+		if attempt == maxRateLimitRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		wait := retryAfter(resp.Header, t.limiter.now())
+		debugf("rateLimitTransport", "too many requests, retrying in %v", wait)
+		resp.Body.Close()
+		t.limiter.pause(wait)
+	}
+}
+
+// withRateLimit returns a copy of client that sends requests through limiter.
+func withRateLimit(client *http.Client, limiter *RateLimiter) *http.Client {
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	limited := *client
+	limited.Transport = &rateLimitTransport{limiter: limiter, next: transport}
+	return &limited
+}
+
+// rateLimiterParam returns the limiter set in the "rate_limiter" parameter, or a new one
+// configured by the "rate_limit" and "rate_burst" parameters, or nil if there's no limit.
+func rateLimiterParam(params Params) *RateLimiter {
+	if limiter, ok := params["rate_limiter"].(*RateLimiter); ok {
+		return limiter
+	}
+
+	var rate float64
+	switch v := params["rate_limit"].(type) {
+	case float64:
+		rate = v
+	case int:
+		rate = float64(v)
+	default:
+		return nil
+	}
+
+	burst, _ := params["rate_burst"].(int)
+	return NewRateLimiter(rate, burst)
+}
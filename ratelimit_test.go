@@ -0,0 +1,69 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if wait := limiter.reserve(); wait != 0 {
+			t.Fatalf("request %d should be allowed in burst, got wait %v", i, wait)
+		}
+	}
+
+	if wait := limiter.reserve(); wait != 500*time.Millisecond {
+		t.Errorf("want 500ms wait after burst, got %v", wait)
+	}
+
+	now = now.Add(time.Second)
+	if wait := limiter.reserve(); wait != 0 {
+		t.Errorf("tokens should refill, got wait %v", wait)
+	}
+
+	header := http.Header{}
+	header.Set("X-Ratelimit-Remaining", "0")
+	header.Set("X-Ratelimit-Reset", "30")
+	limiter.update(header)
+
+	now = now.Add(10 * time.Second)
+	if wait := limiter.reserve(); wait != 20*time.Second {
+		t.Errorf("want pause until limit resets, got %v", wait)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1"}`, strings.TrimPrefix(r.URL.Path, "/accounts/"))
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test", "rate_limit": 100})
+	if _, err := ms.LoadAccount(testAddress); err != nil {
+		t.Fatalf("LoadAccount should be retried: %v", err)
+	}
+
+	if hits != 2 {
+		t.Errorf("want 2 requests, got %d", hits)
+	}
+
+	if ms.params["rate_limiter"] == nil || ms.getTx().httpClient.Transport.(*rateLimitTransport).limiter != ms.params["rate_limiter"] {
+		t.Errorf("transactions should share the client's limiter")
+	}
+}
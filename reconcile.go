@@ -0,0 +1,411 @@
+package microstellar
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ReconcileStatus is the state of an Invoice, or the classification of a received payment.
+type ReconcileStatus string
+
+// Reconciliation statuses.
+const (
+	ReconcileOpen        ReconcileStatus = "open"         // invoice: nothing received yet
+	ReconcileMatched     ReconcileStatus = "matched"      // exactly the expected amount was received
+	ReconcileUnderpaid   ReconcileStatus = "underpaid"    // less than the expected amount was received
+	ReconcileOverpaid    ReconcileStatus = "overpaid"     // more than the expected amount was received
+	ReconcileUnknownMemo ReconcileStatus = "unknown_memo" // payment: no invoice has the payment's memo
+	ReconcileWrongAsset  ReconcileStatus = "wrong_asset"  // payment: the invoice expects a different asset
+)
+
+// Invoice is a payment expected by a Reconciler, identified by the memo that the payer must
+// attach. Memo is the memo's text, decimal ID, or base64-encoded hash, depending on MemoType.
+type Invoice struct {
+	ID       string   `json:"id"` // your reference for the invoice
+	MemoType MemoType `json:"memo_type"`
+	Memo     string   `json:"memo"`
+	Amount   string   `json:"amount"`
+	Asset    *Asset   `json:"asset"`
+
+	// Maintained by the Reconciler.
+	Received string          `json:"received"` // total received in Asset
+	Status   ReconcileStatus `json:"status"`
+	Payments []string        `json:"payments"` // IDs of the payments received, in any asset
+}
+
+// ReconcileEvent is emitted by a Reconciler for every payment it processes.
+type ReconcileEvent struct {
+	Status  ReconcileStatus
+	Payment *Payment
+	Invoice *Invoice // a snapshot of the invoice after the payment, or nil for unknown memos
+}
+
+// ReconcileStore persists a Reconciler's invoices and stream cursor. Implement it to keep
+// reconciliation state in your own database.
+type ReconcileStore interface {
+	// GetInvoice returns the invoice for the memo key, or nil if there is none.
+	GetInvoice(memoKey string) (*Invoice, error)
+	// PutInvoice saves invoice under the memo key.
+	PutInvoice(memoKey string, invoice *Invoice) error
+	// GetCursor returns the paging token of the last payment processed, or "".
+	GetCursor() (string, error)
+	// PutCursor saves the paging token of the last payment processed.
+	PutCursor(cursor string) error
+}
+
+// MemoryReconcileStore is a ReconcileStore that keeps state in memory.
+type MemoryReconcileStore struct {
+	mu       sync.Mutex
+	Invoices map[string]*Invoice `json:"invoices"`
+	Cursor   string              `json:"cursor"`
+}
+
+// NewMemoryReconcileStore returns an empty MemoryReconcileStore.
+func NewMemoryReconcileStore() *MemoryReconcileStore {
+	return &MemoryReconcileStore{Invoices: map[string]*Invoice{}}
+}
+
+// GetInvoice implements ReconcileStore.
+func (s *MemoryReconcileStore) GetInvoice(memoKey string) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.Invoices[memoKey]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *invoice
+	return &copied, nil
+}
+
+// PutInvoice implements ReconcileStore.
+func (s *MemoryReconcileStore) PutInvoice(memoKey string, invoice *Invoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *invoice
+	s.Invoices[memoKey] = &copied
+	return nil
+}
+
+// GetCursor implements ReconcileStore.
+func (s *MemoryReconcileStore) GetCursor() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Cursor, nil
+}
+
+// PutCursor implements ReconcileStore.
+func (s *MemoryReconcileStore) PutCursor(cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Cursor = cursor
+	return nil
+}
+
+// FileReconcileStore is a ReconcileStore that keeps state in memory, and saves it to a JSON
+// file on every change.
+type FileReconcileStore struct {
+	*MemoryReconcileStore
+	path string
+}
+
+// NewFileReconcileStore returns a FileReconcileStore backed by the file at path, loading any
+// state already saved there.
+func NewFileReconcileStore(path string) (*FileReconcileStore, error) {
+	store := &FileReconcileStore{MemoryReconcileStore: NewMemoryReconcileStore(), path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read reconciliation state")
+	}
+
+	if err := json.Unmarshal(data, store.MemoryReconcileStore); err != nil {
+		return nil, errors.Wrap(err, "can't decode reconciliation state")
+	}
+
+	return store, nil
+}
+
+// save writes the state to a temporary file, and renames it over the store's file.
+func (s *FileReconcileStore) save() error {
+	s.mu.Lock()
+	data, err := json.Marshal(s.MemoryReconcileStore)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// PutInvoice implements ReconcileStore.
+func (s *FileReconcileStore) PutInvoice(memoKey string, invoice *Invoice) error {
+	s.MemoryReconcileStore.PutInvoice(memoKey, invoice)
+	return s.save()
+}
+
+// PutCursor implements ReconcileStore.
+func (s *FileReconcileStore) PutCursor(cursor string) error {
+	s.MemoryReconcileStore.PutCursor(cursor)
+	return s.save()
+}
+
+// memoKey returns the canonical key for a memo, given its type and string encoding.
+func memoKey(memoType MemoType, memo string) (string, error) {
+	switch memoType {
+	case MemoText:
+		return "text:" + memo, nil
+	case MemoID:
+		id, err := strconv.ParseUint(memo, 10, 64)
+		if err != nil {
+			return "", errors.Errorf("bad memo ID: %s", memo)
+		}
+		return "id:" + strconv.FormatUint(id, 10), nil
+	case MemoHash, MemoReturn:
+		decoded, err := base64.StdEncoding.DecodeString(memo)
+		if err != nil || len(decoded) != 32 {
+			return "", errors.Errorf("bad memo hash (must be 32 bytes, base64-encoded): %s", memo)
+		}
+		return "hash:" + base64.StdEncoding.EncodeToString(decoded), nil
+	}
+
+	return "", errors.Errorf("invoices need a memo")
+}
+
+// paymentMemoKey returns the memo key for a payment's memo (as loaded from Horizon.)
+func paymentMemoKey(payment *Payment) (string, error) {
+	switch payment.Memo.Type {
+	case "text":
+		return memoKey(MemoText, payment.Memo.Value)
+	case "id":
+		return memoKey(MemoID, payment.Memo.Value)
+	case "hash", "return":
+		return memoKey(MemoHash, payment.Memo.Value)
+	}
+
+	return "", errors.Errorf("payment has no memo")
+}
+
+// Reconciler matches payments received by an account against expected invoices, keyed by
+// memo. Register invoices with Expect, and feed it payments with Watch (or Process.) Each
+// payment is classified as matched, underpaid, or overpaid (comparing the total received for
+// the invoice with the expected amount), or as having an unknown memo or the wrong asset.
+//
+//   r := microstellar.NewReconciler("merchant_address", nil)
+//   r.Expect(microstellar.Invoice{ID: "order-1", MemoType: microstellar.MemoID, Memo: "1001",
+//       Amount: "25", Asset: USD})
+//
+//   watcher, err := r.Watch(ms)
+//   for event := range watcher.Ch {
+//       if event.Invoice != nil {
+//           log.Printf("%s: %s", event.Invoice.ID, event.Status)
+//       }
+//   }
+type Reconciler struct {
+	mu      sync.Mutex
+	address string
+	store   ReconcileStore
+}
+
+// NewReconciler returns a Reconciler for payments received by address, which keeps its state
+// in store (a MemoryReconcileStore if nil.)
+func NewReconciler(address string, store ReconcileStore) *Reconciler {
+	if store == nil {
+		store = NewMemoryReconcileStore()
+	}
+
+	return &Reconciler{address: address, store: store}
+}
+
+// Expect registers invoice, replacing any existing invoice with the same memo.
+func (r *Reconciler) Expect(invoice Invoice) error {
+	key, err := memoKey(invoice.MemoType, invoice.Memo)
+	if err != nil {
+		return errors.Wrap(err, "bad invoice")
+	}
+
+	if amount, err := ParseAmount(invoice.Amount); err != nil || amount <= 0 {
+		return errors.Errorf("bad invoice amount: %s", invoice.Amount)
+	}
+
+	if invoice.Asset == nil {
+		invoice.Asset = NativeAsset
+	}
+
+	if err := invoice.Asset.Validate(); err != nil {
+		return errors.Wrap(err, "bad invoice asset")
+	}
+
+	invoice.Received = "0"
+	invoice.Status = ReconcileOpen
+	invoice.Payments = nil
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.store.PutInvoice(key, &invoice)
+}
+
+// Invoice returns the current state of the invoice with the given memo, or nil if there is none.
+func (r *Reconciler) Invoice(memoType MemoType, memo string) (*Invoice, error) {
+	key, err := memoKey(memoType, memo)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.store.GetInvoice(key)
+}
+
+// Process classifies payment and updates the matching invoice. It returns nil (with no error)
+// for payments that aren't incoming payments to the reconciler's address, or that were already
+// processed.
+func (r *Reconciler) Process(payment *Payment) (*ReconcileEvent, error) {
+	if (payment.Type != "payment" && payment.Type != "path_payment") || payment.To != r.address {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := &ReconcileEvent{Status: ReconcileUnknownMemo, Payment: payment}
+
+	key, err := paymentMemoKey(payment)
+	if err != nil {
+		return event, nil
+	}
+
+	invoice, err := r.store.GetInvoice(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load invoice")
+	}
+
+	if invoice == nil {
+		return event, nil
+	}
+
+	for _, id := range invoice.Payments {
+		if id == payment.ID {
+			return nil, nil
+		}
+	}
+
+	asset := NewAsset(payment.AssetCode, payment.AssetIssuer, AssetType(payment.AssetType))
+	if !asset.Equals(*invoice.Asset) {
+		// Record the payment so that it isn't reported again, but don't count it.
+		invoice.Payments = append(invoice.Payments, payment.ID)
+		if err := r.store.PutInvoice(key, invoice); err != nil {
+			return nil, errors.Wrap(err, "can't save invoice")
+		}
+
+		event.Status = ReconcileWrongAsset
+		event.Invoice = invoice
+		return event, nil
+	}
+
+	received, _ := ParseAmount(invoice.Received)
+	amount, err := ParseAmount(payment.Amount)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bad payment amount: %s", payment.Amount)
+	}
+
+	expected, _ := ParseAmount(invoice.Amount)
+	received += amount
+
+	switch {
+	case received < expected:
+		invoice.Status = ReconcileUnderpaid
+	case received == expected:
+		invoice.Status = ReconcileMatched
+	default:
+		invoice.Status = ReconcileOverpaid
+	}
+
+	invoice.Received = ToAmountString(received)
+	invoice.Payments = append(invoice.Payments, payment.ID)
+	if err := r.store.PutInvoice(key, invoice); err != nil {
+		return nil, errors.Wrap(err, "can't save invoice")
+	}
+
+	event.Status = invoice.Status
+	event.Invoice = invoice
+	return event, nil
+}
+
+// ReconcileWatcher is returned by Reconciler.Watch.
+type ReconcileWatcher struct {
+	Watcher
+
+	// Ch gets a *ReconcileEvent for every payment received.
+	Ch chan *ReconcileEvent
+}
+
+// Watch streams payments received by the reconciler's address from ms, processes them, and
+// emits the results on ReconcileWatcher.Ch. The stream resumes after the last payment
+// processed, as recorded in the store, unless Options.WithCursor is set.
+func (r *Reconciler) Watch(ms *MicroStellar, options ...*Options) (*ReconcileWatcher, error) {
+	opts := *mergeOptions(options)
+	if !opts.hasCursor {
+		cursor, err := r.store.GetCursor()
+		if err != nil {
+			return nil, ms.wrapf(err, "can't load reconciliation cursor")
+		}
+
+		if cursor != "" {
+			opts.WithCursor(cursor)
+		}
+	}
+
+	payments, err := ms.WatchPayments(r.address, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ReconcileWatcher{
+		Ch:      make(chan *ReconcileEvent),
+		Watcher: Watcher{Err: payments.Err, Done: payments.Done},
+	}
+
+	go func() {
+		defer close(w.Ch)
+
+		for payment := range payments.Ch {
+			event, err := r.Process(payment)
+			if err == nil && payment.PagingToken != "" {
+				err = r.store.PutCursor(payment.PagingToken)
+			}
+
+			if err != nil {
+				debugf("Reconciler.Watch", "stopping: %v", err)
+				*w.Err = err
+				payments.Done()
+				for range payments.Ch {
+				}
+				return
+			}
+
+			if event != nil {
+				w.Ch <- event
+			}
+		}
+	}()
+
+	return w, nil
+}
@@ -0,0 +1,86 @@
+package microstellar
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReconciler(t *testing.T) {
+	merchant := testAddress
+	USD := NewAsset("USD", toAddress(testOtherSeed), Credit4Type)
+
+	path := filepath.Join(t.TempDir(), "reconcile.json")
+	store, err := NewFileReconcileStore(path)
+	if err != nil {
+		t.Fatalf("can't create store: %v", err)
+	}
+
+	r := NewReconciler(merchant, store)
+	if err := r.Expect(Invoice{ID: "order-1", MemoType: MemoID, Memo: "1001", Amount: "25", Asset: USD}); err != nil {
+		t.Fatalf("Expect failed: %v", err)
+	}
+
+	if err := r.Expect(Invoice{ID: "order-2", MemoType: MemoText, Memo: "order-2", Amount: "10"}); err != nil {
+		t.Fatalf("Expect failed: %v", err)
+	}
+
+	if err := r.Expect(Invoice{ID: "bad", Amount: "10"}); err == nil {
+		t.Errorf("invoices without memos should be rejected")
+	}
+
+	payment := func(id string, memoType string, memo string, amount string, asset *Asset) *Payment {
+		p := &Payment{ID: id, Type: "payment", To: merchant, Amount: amount,
+			AssetType: string(asset.Type), AssetCode: asset.Code, AssetIssuer: asset.Issuer}
+		p.Memo.Type = memoType
+		p.Memo.Value = memo
+		return p
+	}
+
+	tests := []struct {
+		payment *Payment
+		want    ReconcileStatus
+	}{
+		{payment("1", "id", "1001", "10", USD), ReconcileUnderpaid},
+		{payment("1", "id", "1001", "10", USD), ""}, // duplicate
+		{payment("2", "id", "1001", "5", NativeAsset), ReconcileWrongAsset},
+		{payment("2", "id", "1001", "5", NativeAsset), ""}, // duplicate
+		{payment("3", "id", "1001", "15", USD), ReconcileMatched},
+		{payment("4", "text", "order-2", "12", NativeAsset), ReconcileOverpaid},
+		{payment("5", "text", "order-3", "12", NativeAsset), ReconcileUnknownMemo},
+		{payment("6", "none", "", "12", NativeAsset), ReconcileUnknownMemo},
+	}
+
+	for _, test := range tests {
+		event, err := r.Process(test.payment)
+		if err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+
+		status := ReconcileStatus("")
+		if event != nil {
+			status = event.Status
+		}
+
+		if status != test.want {
+			t.Errorf("payment %s: want %q, got %q", test.payment.ID, test.want, status)
+		}
+	}
+
+	// Outgoing payments are ignored.
+	outgoing := payment("7", "id", "1001", "1", USD)
+	outgoing.To = "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"
+	if event, _ := r.Process(outgoing); event != nil {
+		t.Errorf("outgoing payments should be ignored")
+	}
+
+	// State survives a restart.
+	store, err = NewFileReconcileStore(path)
+	if err != nil {
+		t.Fatalf("can't reload store: %v", err)
+	}
+
+	invoice, _ := NewReconciler(merchant, store).Invoice(MemoID, "1001")
+	if invoice == nil || invoice.Status != ReconcileMatched || invoice.Received != "25.0000000" || len(invoice.Payments) != 3 {
+		t.Errorf("bad reloaded invoice: %+v", invoice)
+	}
+}
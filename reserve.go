@@ -0,0 +1,213 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+	"github.com/stellar/go/clients/horizon"
+)
+
+// DefaultBaseReserve is the base reserve (0.5 lumens) used when the network's isn't known.
+const DefaultBaseReserve = Amount(5000000)
+
+// InsufficientBalanceError is returned by Pay when the source account can't afford a payment
+// without dipping into its reserve or offer liabilities. Use errors.Cause(err) to get at it.
+type InsufficientBalanceError struct {
+	Address   string // the paying account
+	Asset     *Asset // the asset being spent
+	Amount    Amount // the amount needed, including fees
+	Spendable Amount // the amount available
+}
+
+// Error implements the error interface.
+func (e *InsufficientBalanceError) Error() string {
+	code := e.Asset.Code
+	if e.Asset.IsNative() {
+		code = "XLM"
+	}
+
+	return fmt.Sprintf("insufficient spendable balance in %s: need %s %s, have %s", e.Address, e.Amount, code, e.Spendable)
+}
+
+// Subentries returns the number of subentries (trustlines, offers, data entries, and signers other
+// than the master key) that the account's minimum balance is based on. Accounts loaded from horizon
+// carry the exact count. Otherwise, it's counted from the loaded trustlines, signers, and data
+// entries, which excludes offers.
+func (account *Account) Subentries() int32 {
+	if account.SubentryCount > 0 {
+		return account.SubentryCount
+	}
+
+	count := len(account.Balances) + len(account.Data)
+	for _, signer := range account.Signers {
+		if signer.PublicKey != "" && signer.PublicKey != account.Address {
+			count++
+		}
+	}
+
+	return int32(count)
+}
+
+// MinimumBalance returns the lumens that account must hold, i.e., (2 + subentries) * baseReserve.
+// Use ms.LoadBaseReserve to get the network's base reserve.
+func (account *Account) MinimumBalance(baseReserve Amount) Amount {
+	minimum, err := baseReserve.Mul(2+int64(account.Subentries()), 1)
+	if err != nil {
+		return Amount(0)
+	}
+
+	return minimum
+}
+
+// SpendableBalance returns the amount of asset that account can send. For lumens, this excludes
+// the minimum balance (computed with account.BaseReserve, or DefaultBaseReserve if unset), and
+// for all assets, the amount locked up in sell offers. Returns zero if the account doesn't trust
+// asset.
+//
+//   account, err := ms.LoadAccount("GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ")
+//   account.BaseReserve, err = ms.LoadBaseReserve()
+//   spendable := account.SpendableBalance(microstellar.NativeAsset)
+func (account *Account) SpendableBalance(asset *Asset) Amount {
+	var balance *Balance
+	if asset.IsNative() {
+		balance = &account.NativeBalance
+	} else {
+		for i := range account.Balances {
+			if asset.Equals(*account.Balances[i].Asset) {
+				balance = &account.Balances[i]
+				break
+			}
+		}
+	}
+
+	if balance == nil {
+		return Amount(0)
+	}
+
+	spendable, err := balance.AmountValue()
+	if err != nil {
+		return Amount(0)
+	}
+
+	if balance.SellingLiabilities != "" {
+		if liabilities, err := AmountFromString(balance.SellingLiabilities); err == nil {
+			spendable -= liabilities
+		}
+	}
+
+	if asset.IsNative() {
+		baseReserve := account.BaseReserve
+		if baseReserve == 0 {
+			baseReserve = DefaultBaseReserve
+		}
+
+		spendable -= account.MinimumBalance(baseReserve)
+	}
+
+	if spendable < 0 {
+		return Amount(0)
+	}
+
+	return spendable
+}
+
+// LoadBaseReserve returns the base reserve of the latest ledger on the network.
+func (ms *MicroStellar) LoadBaseReserve(options ...*Options) (Amount, error) {
+	if ms.fake {
+		return DefaultBaseReserve, ms.success()
+	}
+
+	tx := ms.queryTx(options)
+	client := tx.GetClient()
+	endpoint := strings.TrimRight(client.URL, "/") + "/ledgers?order=desc&limit=1"
+
+	debugf("LoadBaseReserve", "loading latest ledger: %s", endpoint)
+	resp, err := client.HTTP.Get(endpoint)
+	if err != nil {
+		return 0, ms.wrapf(err, "can't load latest ledger")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, ms.errorf("can't load latest ledger: status %d", resp.StatusCode)
+	}
+
+	var page struct {
+		Embedded struct {
+			Records []horizon.Ledger `json:"records"`
+		} `json:"_embedded"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return 0, ms.wrapf(err, "can't decode latest ledger")
+	}
+
+	if len(page.Embedded.Records) == 0 || page.Embedded.Records[0].BaseReserve <= 0 {
+		return 0, ms.errorf("can't load latest ledger: no base reserve")
+	}
+
+	return Amount(page.Embedded.Records[0].BaseReserve), ms.success()
+}
+
+// checkSpendable makes sure that address can pay amount of asset, plus fee stroops of lumens,
+// without going below its minimum balance or selling liabilities. Issuers can always pay their
+// own assets.
+func (ms *MicroStellar) checkSpendable(address string, asset *Asset, amount string, fee int64, options []*Options) error {
+	if asset.Issuer == address {
+		return nil
+	}
+
+	needed, err := AmountFromString(amount)
+	if err != nil {
+		return err
+	}
+
+	account, err := ms.LoadAccount(address, options...)
+	if err != nil {
+		return err
+	}
+
+	if asset.IsNative() {
+		needed += Amount(fee)
+		if account.BaseReserve, err = ms.LoadBaseReserve(options...); err != nil {
+			return err
+		}
+	}
+
+	if spendable := account.SpendableBalance(asset); spendable < needed {
+		return errors.WithStack(&InsufficientBalanceError{Address: address, Asset: asset, Amount: needed, Spendable: spendable})
+	}
+
+	return nil
+}
+
+// checkPayment runs checkSpendable for Pay. For path payments, it checks the maximum amount of
+// the send asset. Skipped for multi-op transactions and with Opts().SkipBalanceCheck().
+func (ms *MicroStellar) checkPayment(sourceAddressOrSeed string, amount string, asset *Asset, options []*Options) error {
+	if ms.fake || ms.tx != nil {
+		return nil
+	}
+
+	// The transaction source pays the fee, unless a channel account does.
+	fee := int64(build.DefaultBaseFee)
+	if len(options) > 0 {
+		opts := options[0]
+		if opts.skipBalanceCheck {
+			return nil
+		}
+
+		if opts.channelSeed != "" {
+			fee = 0
+		}
+
+		if opts.sendAsset != nil {
+			asset, amount = opts.sendAsset, opts.maxAmount
+		}
+	}
+
+	return ms.checkSpendable(toAddress(sourceAddressOrSeed), asset, amount, fee, options)
+}
@@ -0,0 +1,87 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSpendableBalance(t *testing.T) {
+	USD := NewAsset("USD", testAddress, Credit4Type)
+	account := &Account{
+		Address:       testAddress,
+		NativeBalance: Balance{Asset: NativeAsset, Amount: "10", SellingLiabilities: "1.5"},
+		Balances:      []Balance{{Asset: USD, Amount: "100", Limit: "1000", SellingLiabilities: "25"}},
+		Signers:       []Signer{{PublicKey: testAddress}, {PublicKey: toAddress(testOtherSeed)}},
+		Data:          map[string]string{"key": "dmFsdWU="},
+	}
+
+	// One trustline, one signer, and one data entry.
+	if account.Subentries() != 3 || account.MinimumBalance(DefaultBaseReserve).String() != "2.5000000" {
+		t.Errorf("bad minimum balance: %d subentries, %s", account.Subentries(), account.MinimumBalance(DefaultBaseReserve))
+	}
+
+	if spendable := account.SpendableBalance(NativeAsset); spendable.String() != "6.0000000" {
+		t.Errorf("bad native spendable balance: %s", spendable)
+	}
+
+	account.SubentryCount = 5
+	account.BaseReserve = MustAmount("1")
+	if spendable := account.SpendableBalance(NativeAsset); spendable.String() != "1.5000000" {
+		t.Errorf("bad native spendable balance with horizon subentries: %s", spendable)
+	}
+
+	if spendable := account.SpendableBalance(USD); spendable.String() != "75.0000000" {
+		t.Errorf("bad USD spendable balance: %s", spendable)
+	}
+
+	if spendable := account.SpendableBalance(NewAsset("EUR", testAddress, Credit4Type)); !spendable.IsZero() {
+		t.Errorf("untrusted assets should not be spendable: %s", spendable)
+	}
+}
+
+func TestPayBalanceCheck(t *testing.T) {
+	submitted := 0
+	funded := func(address string) (string, bool) {
+		return `"subentry_count": 2,
+			"balances": [{"asset_type": "native", "balance": "10.0000000", "selling_liabilities": "1.0000000"}]`, true
+	}
+
+	server := newFakeHorizon(funded, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ledgers":
+			fmt.Fprint(w, `{"_embedded": {"records": [{"sequence": 2, "base_reserve_in_stroops": 5000000}]}}`)
+		case "/transactions":
+			submitted++
+			fmt.Fprint(w, `{"hash": "hash", "ledger": 2}`)
+		}
+	})
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	balance, err := ms.LoadBaseReserve()
+	if err != nil || balance != DefaultBaseReserve {
+		t.Errorf("bad base reserve: %s, %v", balance, err)
+	}
+
+	// 10 - 1 (liabilities) - 2 (reserve) leaves 7 lumens, less the fee.
+	err = ms.PayNative(testOtherSeed, testAddress, "7", Opts().SkipMemoRequiredCheck())
+	balanceErr, ok := errors.Cause(err).(*InsufficientBalanceError)
+	if !ok || balanceErr.Spendable.String() != "7.0000000" || balanceErr.Amount.String() != "7.0000100" {
+		t.Errorf("want insufficient balance error, got %v", err)
+	}
+
+	if err := ms.PayNative(testOtherSeed, testAddress, "6.99", Opts().SkipMemoRequiredCheck()); err != nil {
+		t.Errorf("PayNative failed: %v", err)
+	}
+
+	if err := ms.PayNative(testOtherSeed, testAddress, "7", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+		t.Errorf("PayNative without balance check failed: %v", err)
+	}
+
+	if submitted != 2 {
+		t.Errorf("want 2 submitted payments, got %d", submitted)
+	}
+}
@@ -0,0 +1,318 @@
+package microstellar
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+// sep10Challenge is the response from a SEP-10 challenge request.
+type sep10Challenge struct {
+	Transaction       string `json:"transaction"`
+	NetworkPassphrase string `json:"network_passphrase"`
+	Error             string `json:"error"`
+}
+
+// sep10Token is the response from a SEP-10 token request.
+type sep10Token struct {
+	Token string `json:"token"`
+	Error string `json:"error"`
+}
+
+// SEP10Authenticate authenticates the account for seed against an anchor's SEP-10 web authentication
+// endpoint (WEB_AUTH_ENDPOINT in the anchor's stellar.toml), and returns the JWT issued by the anchor.
+//
+// The challenge transaction is checked before it is signed: it must have sequence number 0, a
+// single manage_data operation sourced from the client account, valid time bounds, and a valid
+// signature from the server's signing key. Use Opts().WithServerKey(address) to set the key.
+// Otherwise, it's read from SIGNING_KEY in the stellar.toml of the endpoint's domain, and
+// authentication fails if it isn't published.
+//
+//   token, err := ms.SEP10Authenticate("https://anchor.com/auth", "SDKORMIXFL2QW2UC3HWJ4GKL4PYFUMDOPEJMGWVQBW4GWJ5W2ZBOGRSZ",
+//       microstellar.Opts().WithServerKey("GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"))
+func (ms *MicroStellar) SEP10Authenticate(webAuthEndpoint string, seed string, options ...*Options) (string, error) {
+	if err := ValidSeed(seed); err != nil {
+		return "", ms.wrapf(err, "can't authenticate")
+	}
+
+	kp, err := keypair.Parse(seed)
+	if err != nil {
+		return "", ms.wrapf(err, "can't authenticate")
+	}
+
+	opts := mergeOptions(options)
+	serverKey := opts.serverKey
+	if serverKey == "" {
+		if serverKey, err = ms.sep10ServerKey(webAuthEndpoint, options); err != nil {
+			return "", ms.wrapf(err, "can't authenticate")
+		}
+	}
+
+	if err := ValidAddress(serverKey); err != nil {
+		return "", ms.wrapf(err, "can't authenticate: bad server key")
+	}
+
+	query := url.Values{}
+	query.Add("account", kp.Address())
+
+	endpoint := webAuthEndpoint + "?" + query.Encode()
+	if strings.Contains(webAuthEndpoint, "?") {
+		endpoint = webAuthEndpoint + "&" + query.Encode()
+	}
+
+	debugf("SEP10Authenticate", "requesting challenge from: %s", endpoint)
+	client := ms.httpClient(options)
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return "", ms.wrapf(err, "could not fetch challenge")
+	}
+
+	var challenge sep10Challenge
+	if err := decodeJSONResponse(resp, &challenge); err != nil {
+		return "", ms.wrapf(err, "bad challenge response")
+	}
+
+	if challenge.Error != "" {
+		return "", ms.errorf("challenge request failed: %s", challenge.Error)
+	}
+
+	tx := ms.getTx()
+	if challenge.NetworkPassphrase != "" && challenge.NetworkPassphrase != tx.network.Passphrase {
+		return "", ms.errorf("challenge is for a different network: %s", challenge.NetworkPassphrase)
+	}
+
+	txe, err := DecodeTx(challenge.Transaction)
+	if err != nil {
+		return "", ms.wrapf(err, "bad challenge transaction")
+	}
+
+	clientAddress, err := verifyChallengeStructure(txe, serverKey, tx.network.Passphrase, time.Now())
+	if err != nil {
+		return "", ms.wrapf(err, "invalid challenge")
+	}
+
+	if clientAddress != kp.Address() {
+		return "", ms.errorf("challenge is for a different account: %s", clientAddress)
+	}
+
+	signedTx, err := ms.SignTransaction(challenge.Transaction, seed)
+	if err != nil {
+		return "", ms.wrapf(err, "could not sign challenge")
+	}
+
+	body, err := json.Marshal(map[string]string{"transaction": signedTx})
+	if err != nil {
+		return "", ms.wrapf(err, "could not marshal challenge")
+	}
+
+	debugf("SEP10Authenticate", "submitting signed challenge to: %s", webAuthEndpoint)
+	resp, err = client.Post(webAuthEndpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", ms.wrapf(err, "could not submit challenge")
+	}
+
+	var token sep10Token
+	if err := decodeJSONResponse(resp, &token); err != nil {
+		return "", ms.wrapf(err, "bad token response")
+	}
+
+	if token.Error != "" || token.Token == "" {
+		return "", ms.errorf("authentication failed: %s", token.Error)
+	}
+
+	return token.Token, ms.success()
+}
+
+// sep10ServerKey returns the SIGNING_KEY published in the stellar.toml of webAuthEndpoint's domain.
+func (ms *MicroStellar) sep10ServerKey(webAuthEndpoint string, options []*Options) (string, error) {
+	u, err := url.Parse(webAuthEndpoint)
+	if err != nil || u.Hostname() == "" {
+		return "", errors.Errorf("bad web auth endpoint: %s", webAuthEndpoint)
+	}
+
+	var doc StellarTOML
+	if err := loadTOML(ms.httpClient(options), u.Hostname(), &doc); err != nil {
+		return "", errors.Wrapf(err, "no server key set, and can't load stellar.toml for %s", u.Hostname())
+	}
+
+	if doc.SigningKey == "" {
+		return "", errors.Errorf("no server key set, and no SIGNING_KEY in stellar.toml for %s", u.Hostname())
+	}
+
+	return doc.SigningKey, nil
+}
+
+// BuildChallengeTx returns a new base64-encoded SEP-10 challenge transaction for clientAddress, signed
+// by serverSeed. The challenge is valid for timeout from now. Use this to implement the GET handler of
+// your own web authentication endpoint.
+func (ms *MicroStellar) BuildChallengeTx(serverSeed string, clientAddress string, anchorName string, timeout time.Duration) (string, error) {
+	if err := ValidSeed(serverSeed); err != nil {
+		return "", ms.wrapf(err, "can't build challenge")
+	}
+
+	if err := ValidAddress(clientAddress); err != nil {
+		return "", ms.wrapf(err, "can't build challenge")
+	}
+
+	nonce := make([]byte, 48)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", ms.wrapf(err, "could not generate nonce")
+	}
+
+	now := time.Now()
+	builder, err := build.Transaction(
+		sourceAccount(serverSeed),
+		ms.getTx().network,
+		build.Sequence{Sequence: 0},
+		build.Timebounds{MinTime: uint64(now.Unix()), MaxTime: uint64(now.Add(timeout).Unix())},
+		build.SetData(anchorName+" auth", []byte(base64.StdEncoding.EncodeToString(nonce)),
+			build.SourceAccount{AddressOrSeed: clientAddress}),
+	)
+
+	if err != nil {
+		return "", ms.wrapf(err, "could not build challenge")
+	}
+
+	txe, err := builder.Sign(serverSeed)
+	if err != nil {
+		return "", ms.wrapf(err, "could not sign challenge")
+	}
+
+	b64, err := txe.Base64()
+	if err != nil {
+		return "", ms.wrapf(err, "could not encode challenge")
+	}
+
+	return b64, ms.success()
+}
+
+// VerifyChallengeTx checks a signed SEP-10 challenge transaction returned by a client, and
+// returns the client's address. The challenge must have been built by BuildChallengeTx for
+// serverAddress, be within its time bounds, and carry valid signatures from both the server
+// and the client. Use this to implement the POST handler of your own web authentication
+// endpoint, and issue a token if it succeeds.
+func (ms *MicroStellar) VerifyChallengeTx(challenge string, serverAddress string) (string, error) {
+	if err := ValidAddress(serverAddress); err != nil {
+		return "", ms.wrapf(err, "can't verify challenge")
+	}
+
+	txe, err := DecodeTx(challenge)
+	if err != nil {
+		return "", ms.wrapf(err, "bad challenge transaction")
+	}
+
+	passphrase := ms.getTx().network.Passphrase
+	clientAddress, err := verifyChallengeStructure(txe, serverAddress, passphrase, time.Now())
+	if err != nil {
+		return "", ms.wrapf(err, "invalid challenge")
+	}
+
+	if !hasValidSignature(txe, clientAddress, passphrase) {
+		return "", ms.errorf("invalid challenge: missing client signature")
+	}
+
+	return clientAddress, ms.success()
+}
+
+// verifyChallengeStructure makes sure that txe is a well formed SEP-10 challenge signed by
+// serverAddress, and returns the client address.
+func verifyChallengeStructure(txe *xdr.TransactionEnvelope, serverAddress string, passphrase string, now time.Time) (string, error) {
+	source := txe.Tx.SourceAccount.Address()
+	if source != serverAddress {
+		return "", errors.Errorf("source account %s is not the server account %s", source, serverAddress)
+	}
+
+	if txe.Tx.SeqNum != 0 {
+		return "", errors.Errorf("sequence number must be 0, got %d", txe.Tx.SeqNum)
+	}
+
+	if len(txe.Tx.Operations) != 1 {
+		return "", errors.Errorf("must have exactly one operation, got %d", len(txe.Tx.Operations))
+	}
+
+	op := txe.Tx.Operations[0]
+	if op.Body.Type != xdr.OperationTypeManageData || op.Body.ManageDataOp == nil {
+		return "", errors.Errorf("operation must be manage_data, got %v", op.Body.Type)
+	}
+
+	if op.SourceAccount == nil {
+		return "", errors.Errorf("operation must have a source account")
+	}
+
+	if value := op.Body.ManageDataOp.DataValue; value == nil || len(*value) != 64 {
+		return "", errors.Errorf("operation must have a 64-byte nonce")
+	}
+
+	bounds := txe.Tx.TimeBounds
+	if bounds == nil {
+		return "", errors.Errorf("must have time bounds")
+	}
+
+	if uint64(now.Unix()) < uint64(bounds.MinTime) || (bounds.MaxTime != 0 && uint64(now.Unix()) > uint64(bounds.MaxTime)) {
+		return "", errors.Errorf("challenge expired or not yet valid")
+	}
+
+	if !hasValidSignature(txe, source, passphrase) {
+		return "", errors.Errorf("missing server signature")
+	}
+
+	return op.SourceAccount.Address(), nil
+}
+
+// hasValidSignature returns true if txe carries a valid signature from address on the network
+// with the given passphrase.
+func hasValidSignature(txe *xdr.TransactionEnvelope, address string, passphrase string) bool {
+	kp, err := keypair.Parse(address)
+	if err != nil {
+		return false
+	}
+
+	hash, err := network.HashTransaction(&txe.Tx, passphrase)
+	if err != nil {
+		return false
+	}
+
+	for _, sig := range txe.Signatures {
+		if kp.Verify(hash[:], sig.Signature) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeJSONResponse reads and unmarshals a JSON response body into object, and closes the body. Error
+// responses are decoded into object too, if possible, so callers can report the server's error.
+func decodeJSONResponse(resp *http.Response, object interface{}) error {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "could not read response")
+	}
+
+	debugf("decodeJSONResponse", "got status %d, body: %s", resp.StatusCode, string(body))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return errors.Errorf("request failed with status %d: %s", resp.StatusCode, errResp.Error)
+		}
+		return errors.Errorf("request failed with status %d", resp.StatusCode)
+	}
+
+	return errors.Wrap(json.Unmarshal(body, object), "could not unmarshal response")
+}
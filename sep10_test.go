@@ -0,0 +1,134 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+)
+
+// newSEP10Server returns a test web authentication server built with the challenge helpers.
+func newSEP10Server(ms *MicroStellar) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			challenge, err := ms.BuildChallengeTx(testSeed, r.URL.Query().Get("account"), "test", 5*time.Minute)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"transaction": challenge})
+			return
+		}
+
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		address, err := ms.VerifyChallengeTx(req["transaction"], testAddress)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "jwt-for-" + address})
+	}))
+}
+
+func TestSEP10Authenticate(t *testing.T) {
+	ms := New("test")
+	server := newSEP10Server(ms)
+	defer server.Close()
+
+	pair, _ := keypair.Parse(testOtherSeed)
+
+	token, err := ms.SEP10Authenticate(server.URL, testOtherSeed, Opts().WithServerKey(testAddress))
+	if err != nil {
+		t.Fatalf("SEP10Authenticate: %v", err)
+	}
+
+	if want := "jwt-for-" + pair.Address(); token != want {
+		t.Errorf("wrong token: want %v, got %v", want, token)
+	}
+
+	_, err = ms.SEP10Authenticate(server.URL, testOtherSeed, Opts().WithServerKey("GAB6FX3WVKZZRUE64H77BRWLDIOIOR4MU27L3ATNVUYKXPX5GF22TOZO"))
+	if err == nil {
+		t.Errorf("challenge from unexpected server key should fail")
+	}
+}
+
+func TestSEP10AuthenticateServerKeyFromTOML(t *testing.T) {
+	signingKey := testAddress
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Scheme == "https" && req.URL.Path == "/.well-known/stellar.toml" {
+			body := "VERSION=\"2.0.0\"\n"
+			if signingKey != "" {
+				body += "SIGNING_KEY=\"" + signingKey + "\"\n"
+			}
+
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+		}
+
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	ms := New("test", Params{"http_client": client})
+	server := newSEP10Server(ms)
+	defer server.Close()
+
+	if _, err := ms.SEP10Authenticate(server.URL, testOtherSeed); err != nil {
+		t.Errorf("SEP10Authenticate with SIGNING_KEY from stellar.toml: %v", err)
+	}
+
+	signingKey = ""
+	if _, err := ms.SEP10Authenticate(server.URL, testOtherSeed); err == nil {
+		t.Errorf("SEP10Authenticate without a server key should fail")
+	}
+}
+
+func TestDecodeJSONResponseStatus(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"token": "", "error": "denied"}`)),
+	}
+
+	var token sep10Token
+	if err := decodeJSONResponse(resp, &token); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("want error with status 401, got %v", err)
+	}
+}
+
+func TestVerifyChallengeTx(t *testing.T) {
+	ms := New("test")
+	pair, _ := keypair.Parse(testOtherSeed)
+
+	challenge, err := ms.BuildChallengeTx(testSeed, pair.Address(), "test", time.Minute)
+	if err != nil {
+		t.Fatalf("BuildChallengeTx: %v", err)
+	}
+
+	if _, err := ms.VerifyChallengeTx(challenge, testAddress); err == nil {
+		t.Errorf("challenge without client signature should fail verification")
+	}
+
+	signed, err := ms.SignTransaction(challenge, testOtherSeed)
+	if err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+
+	address, err := ms.VerifyChallengeTx(signed, testAddress)
+	if err != nil {
+		t.Errorf("VerifyChallengeTx: %v", err)
+	}
+
+	if address != pair.Address() {
+		t.Errorf("wrong client address: want %v, got %v", pair.Address(), address)
+	}
+
+	if _, err := New("public").VerifyChallengeTx(signed, testAddress); err == nil {
+		t.Errorf("challenge signed for another network should fail verification")
+	}
+}
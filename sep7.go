@@ -0,0 +1,335 @@
+package microstellar
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+)
+
+// The SEP-7 URI scheme and operations.
+const (
+	uriScheme = "web+stellar:"
+	uriPayOp  = "pay"
+	uriTxOp   = "tx"
+)
+
+// uriSignaturePrefix is prepended to a URI before it is signed or verified, as specified by SEP-7: 35
+// zero bytes, followed by 4, followed by "stellar.sep.7 - URI Scheme".
+var uriSignaturePrefix = append(append(make([]byte, 35), 4), []byte("stellar.sep.7 - URI Scheme")...)
+
+// PayURI represents a SEP-7 "web+stellar:pay" URI, typically presented as a QR code. The fields map
+// directly to the arguments of MicroStellar.Pay:
+//
+//   p, err := microstellar.ParsePayURI(uri)
+//   opts, err := p.Options()
+//   ms.Pay("source_seed", p.Destination, p.Amount, p.Asset, opts)
+type PayURI struct {
+	Destination       string // Required: address (or federated address) to pay
+	Amount            string // Optional: amount to pay, the wallet asks the user if empty
+	Asset             *Asset // Asset to pay with, defaults to NativeAsset
+	MemoType          string // Optional: MEMO_TEXT, MEMO_ID, MEMO_HASH, or MEMO_RETURN
+	Memo              string // Optional: memo value (hash memos are base64-encoded)
+	Callback          string // Optional: URL to POST the signed transaction to
+	Message           string // Optional: message to show the user (max 300 chars)
+	NetworkPassphrase string // Optional: network to use, defaults to the public network
+	OriginDomain      string // Optional: domain that signed the URI
+	Signature         string // Optional: signature of the origin domain's URI_REQUEST_SIGNING_KEY
+}
+
+// TxURI represents a SEP-7 "web+stellar:tx" URI, which asks the user to sign a transaction. The XDR field
+// can be signed with MicroStellar.SignTransaction.
+type TxURI struct {
+	XDR               string // Required: base64-encoded transaction envelope
+	Replace           string // Optional: SEP-11 fields the wallet should replace
+	Callback          string // Optional: URL to POST the signed transaction to
+	PublicKey         string // Optional: the key that should sign the transaction
+	Message           string // Optional: message to show the user (max 300 chars)
+	NetworkPassphrase string // Optional: network to use, defaults to the public network
+	OriginDomain      string // Optional: domain that signed the URI
+	Signature         string // Optional: signature of the origin domain's URI_REQUEST_SIGNING_KEY
+}
+
+// BuildPayURI returns the "web+stellar:pay" URI for p. Use SignURI to sign the URI if OriginDomain is set.
+func BuildPayURI(p *PayURI) (string, error) {
+	if !ValidAddressOrSeed(p.Destination) && !strings.Contains(p.Destination, "*") {
+		return "", errors.Errorf("invalid destination: %s", p.Destination)
+	}
+
+	if p.Amount != "" {
+		if _, err := ParseAmount(p.Amount); err != nil {
+			return "", errors.Wrapf(err, "invalid amount: %s", p.Amount)
+		}
+	}
+
+	query := url.Values{}
+	query.Set("destination", p.Destination)
+	addOptional(query, "amount", p.Amount)
+
+	if p.Asset != nil && !p.Asset.IsNative() {
+		if err := p.Asset.Validate(); err != nil {
+			return "", errors.Wrap(err, "invalid asset")
+		}
+		query.Set("asset_code", p.Asset.Code)
+		query.Set("asset_issuer", p.Asset.Issuer)
+	}
+
+	if p.MemoType != "" {
+		if err := Opts().setMemo(p.MemoType, p.Memo); err != nil {
+			return "", errors.Wrap(err, "invalid memo")
+		}
+		query.Set("memo_type", p.MemoType)
+		query.Set("memo", p.Memo)
+	}
+
+	addOptional(query, "callback", uriCallback(p.Callback))
+	addOptional(query, "msg", p.Message)
+	addOptional(query, "network_passphrase", p.NetworkPassphrase)
+	addOptional(query, "origin_domain", p.OriginDomain)
+
+	return buildURI(uriPayOp, query, p.Signature), nil
+}
+
+// ParsePayURI parses a "web+stellar:pay" URI.
+func ParsePayURI(uri string) (*PayURI, error) {
+	query, signature, err := parseURI(uri, uriPayOp)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PayURI{
+		Destination:       query.Get("destination"),
+		Amount:            query.Get("amount"),
+		Asset:             NativeAsset,
+		MemoType:          query.Get("memo_type"),
+		Memo:              query.Get("memo"),
+		Callback:          strings.TrimPrefix(query.Get("callback"), "url:"),
+		Message:           query.Get("msg"),
+		NetworkPassphrase: query.Get("network_passphrase"),
+		OriginDomain:      query.Get("origin_domain"),
+		Signature:         signature,
+	}
+
+	if p.Destination == "" {
+		return nil, errors.Errorf("invalid pay URI: missing destination")
+	}
+
+	if p.Amount != "" {
+		if _, err := ParseAmount(p.Amount); err != nil {
+			return nil, errors.Wrapf(err, "invalid pay URI: bad amount: %s", p.Amount)
+		}
+	}
+
+	if code := query.Get("asset_code"); code != "" {
+		p.Asset = NewCreditAsset(code, query.Get("asset_issuer"))
+		if err := p.Asset.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid pay URI: bad asset")
+		}
+	}
+
+	if _, err := p.Options(); err != nil {
+		return nil, errors.Wrap(err, "invalid pay URI")
+	}
+
+	return p, nil
+}
+
+// Options returns the transaction options (currently just the memo) for paying this URI.
+func (p *PayURI) Options() (*Options, error) {
+	opts := Opts()
+	if err := opts.setMemo(p.MemoType, p.Memo); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// String returns the URI.
+func (p *PayURI) String() string {
+	uri, _ := BuildPayURI(p)
+	return uri
+}
+
+// BuildTxURI returns the "web+stellar:tx" URI for t. Use SignURI to sign the URI if OriginDomain is set.
+func BuildTxURI(t *TxURI) (string, error) {
+	if _, err := DecodeTx(t.XDR); err != nil {
+		return "", errors.Wrap(err, "invalid transaction")
+	}
+
+	if t.PublicKey != "" {
+		if err := ValidAddress(t.PublicKey); err != nil {
+			return "", errors.Wrap(err, "invalid public key")
+		}
+	}
+
+	query := url.Values{}
+	query.Set("xdr", t.XDR)
+	addOptional(query, "replace", t.Replace)
+	addOptional(query, "callback", uriCallback(t.Callback))
+	addOptional(query, "pubkey", t.PublicKey)
+	addOptional(query, "msg", t.Message)
+	addOptional(query, "network_passphrase", t.NetworkPassphrase)
+	addOptional(query, "origin_domain", t.OriginDomain)
+
+	return buildURI(uriTxOp, query, t.Signature), nil
+}
+
+// ParseTxURI parses a "web+stellar:tx" URI.
+func ParseTxURI(uri string) (*TxURI, error) {
+	query, signature, err := parseURI(uri, uriTxOp)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TxURI{
+		XDR:               query.Get("xdr"),
+		Replace:           query.Get("replace"),
+		Callback:          strings.TrimPrefix(query.Get("callback"), "url:"),
+		PublicKey:         query.Get("pubkey"),
+		Message:           query.Get("msg"),
+		NetworkPassphrase: query.Get("network_passphrase"),
+		OriginDomain:      query.Get("origin_domain"),
+		Signature:         signature,
+	}
+
+	if t.XDR == "" {
+		return nil, errors.Errorf("invalid tx URI: missing xdr")
+	}
+
+	if _, err := DecodeTx(t.XDR); err != nil {
+		return nil, errors.Wrap(err, "invalid tx URI: bad xdr")
+	}
+
+	return t, nil
+}
+
+// String returns the URI.
+func (t *TxURI) String() string {
+	uri, _ := BuildTxURI(t)
+	return uri
+}
+
+// SignURI signs a SEP-7 URI with seed (which should be the URI_REQUEST_SIGNING_KEY in the stellar.toml
+// of the URI's origin_domain), and returns the URI with the signature appended.
+func SignURI(uri string, seed string) (string, error) {
+	kp, err := keypair.Parse(seed)
+	if err != nil {
+		return "", errors.Wrap(err, "can't sign URI")
+	}
+
+	unsigned, _ := splitURISignature(uri)
+	sig, err := kp.Sign(append(append([]byte{}, uriSignaturePrefix...), []byte(unsigned)...))
+	if err != nil {
+		return "", errors.Wrap(err, "can't sign URI")
+	}
+
+	return unsigned + "&signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// VerifyURISignature returns an error if uri does not carry a valid signature by signingKey.
+func VerifyURISignature(uri string, signingKey string) error {
+	unsigned, signature := splitURISignature(uri)
+	if signature == "" {
+		return errors.Errorf("URI is not signed")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "bad URI signature")
+	}
+
+	kp, err := keypair.Parse(signingKey)
+	if err != nil {
+		return errors.Wrap(err, "bad signing key")
+	}
+
+	if err := kp.Verify(append(append([]byte{}, uriSignaturePrefix...), []byte(unsigned)...), sig); err != nil {
+		return errors.Wrap(err, "invalid URI signature")
+	}
+
+	return nil
+}
+
+// VerifyURI checks that a signed SEP-7 URI was signed by the URI_REQUEST_SIGNING_KEY published in
+// the stellar.toml of the URI's origin_domain. Wallets should only display the origin domain
+// to the user if this succeeds.
+func (ms *MicroStellar) VerifyURI(uri string, options ...*Options) error {
+	unsigned, _ := splitURISignature(uri)
+	parts := strings.SplitN(unsigned, "?", 2)
+	if len(parts) != 2 {
+		return ms.errorf("invalid URI: %s", uri)
+	}
+
+	query, err := url.ParseQuery(parts[1])
+	if err != nil {
+		return ms.wrapf(err, "invalid URI")
+	}
+
+	domain := query.Get("origin_domain")
+	if domain == "" {
+		return ms.errorf("can't verify URI: missing origin_domain")
+	}
+
+	doc, err := ms.LoadStellarTOML(domain, options...)
+	if err != nil {
+		return ms.wrapf(err, "can't verify URI")
+	}
+
+	if doc.URIRequestSigningKey == "" {
+		return ms.errorf("can't verify URI: %s has no URI_REQUEST_SIGNING_KEY", domain)
+	}
+
+	return ms.err(VerifyURISignature(uri, doc.URIRequestSigningKey))
+}
+
+// buildURI assembles a SEP-7 URI for op, with signature (if any) as the last parameter.
+func buildURI(op string, query url.Values, signature string) string {
+	uri := uriScheme + op + "?" + query.Encode()
+	if signature != "" {
+		uri += "&signature=" + url.QueryEscape(signature)
+	}
+
+	return uri
+}
+
+// parseURI checks the scheme and operation of a SEP-7 URI, and returns its parameters and signature.
+func parseURI(uri string, op string) (url.Values, string, error) {
+	if !strings.HasPrefix(uri, uriScheme+op+"?") {
+		return nil, "", errors.Errorf("not a %s%s URI: %s", uriScheme, op, uri)
+	}
+
+	unsigned, signature := splitURISignature(uri)
+	query, err := url.ParseQuery(strings.TrimPrefix(unsigned, uriScheme+op+"?"))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "bad URI parameters")
+	}
+
+	return query, signature, nil
+}
+
+// splitURISignature splits the trailing signature parameter off of uri, and returns the unsigned
+// URI and the decoded signature.
+func splitURISignature(uri string) (string, string) {
+	i := strings.LastIndex(uri, "&signature=")
+	if i < 0 {
+		return uri, ""
+	}
+
+	signature, err := url.QueryUnescape(uri[i+len("&signature="):])
+	if err != nil {
+		return uri[:i], ""
+	}
+
+	return uri[:i], signature
+}
+
+// uriCallback adds the "url:" prefix required by SEP-7 to callback URLs.
+func uriCallback(callback string) string {
+	if callback == "" || strings.HasPrefix(callback, "url:") {
+		return callback
+	}
+
+	return "url:" + callback
+}
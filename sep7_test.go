@@ -0,0 +1,110 @@
+package microstellar
+
+import (
+	"fmt"
+	"log"
+	"testing"
+)
+
+// This example parses a payment request URI (e.g., scanned from a QR code) and pays it.
+func ExampleParsePayURI() {
+	// Create a new MicroStellar client connected to a fake network. To
+	// use a real network replace "fake" below with "test" or "public".
+	ms := New("fake")
+
+	uri := "web+stellar:pay?destination=GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ&amount=12.5" +
+		"&asset_code=USD&asset_issuer=GAT5GKDILNY2G6NOBEIX7XMGSPPZD5MCHZ47MGTW4UL6CX55TKIUNN53" +
+		"&memo_type=MEMO_ID&memo=42"
+
+	p, err := ParsePayURI(uri)
+	if err != nil {
+		log.Fatalf("ParsePayURI: %v", err)
+	}
+
+	opts, err := p.Options()
+	if err != nil {
+		log.Fatalf("Options: %v", err)
+	}
+
+	// Pay the requested amount with the requested memo.
+	err = ms.Pay("SCSMBQYTXKZYY7CLVT6NPPYWVDQYDOQ6BB3QND4OIXC7762JYJYZ3RMK", p.Destination, p.Amount, p.Asset, opts)
+	if err != nil {
+		log.Fatalf("Pay: %v", ErrorString(err))
+	}
+
+	fmt.Printf("%s %s", p.Amount, p.Asset.Code)
+	// Output: 12.5 USD
+}
+
+func TestPayURI(t *testing.T) {
+	USD := NewAsset("USD", "GAT5GKDILNY2G6NOBEIX7XMGSPPZD5MCHZ47MGTW4UL6CX55TKIUNN53", Credit4Type)
+	uri, err := BuildPayURI(&PayURI{
+		Destination: "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ",
+		Amount:      "3",
+		Asset:       USD,
+		MemoType:    "MEMO_TEXT",
+		Memo:        "for beer & pizza",
+		Callback:    "https://example.com/callback",
+	})
+
+	if err != nil {
+		t.Fatalf("BuildPayURI: %v", err)
+	}
+
+	p, err := ParsePayURI(uri)
+	if err != nil {
+		t.Fatalf("ParsePayURI: %v", err)
+	}
+
+	if !p.Asset.Equals(*USD) || p.Amount != "3" || p.Memo != "for beer & pizza" || p.Callback != "https://example.com/callback" {
+		t.Errorf("bad round trip: %s -> %+v", uri, p)
+	}
+
+	opts, _ := p.Options()
+	if opts.memoType != MemoText || opts.memoText != "for beer & pizza" {
+		t.Errorf("wrong memo options: %+v", opts)
+	}
+
+	if _, err := ParsePayURI("web+stellar:pay?amount=3"); err == nil {
+		t.Errorf("pay URI without destination should fail")
+	}
+
+	if _, err := ParsePayURI("web+stellar:tx?xdr=foo"); err == nil {
+		t.Errorf("tx URI should not parse as pay URI")
+	}
+}
+
+func TestTxURI(t *testing.T) {
+	const xdr = "AAAAAJb3jlBt5y04F3kXk47T9MO/Se7NcfhnIxXvWjOCzZ14AAAAZAB50HAAAAABAAAAAAAAAAAAAAABAAAAAAAAAAEAAAAAuIMOnlpDFWhoO8o6VVzH4MZdIpgqr21GMRGG2riMxNoAAAAAAAAAAACYloAAAAAAAAAAAA=="
+
+	uri, err := BuildTxURI(&TxURI{XDR: xdr, Message: "please sign", OriginDomain: "example.com"})
+	if err != nil {
+		t.Fatalf("BuildTxURI: %v", err)
+	}
+
+	signed, err := SignURI(uri, "SAJ4FP6H3FSTE4P7UOONX6ULQ4UKDMK7XXDDKGYTO6ZCRIF2ZU6LZM3D")
+	if err != nil {
+		t.Fatalf("SignURI: %v", err)
+	}
+
+	if err := VerifyURISignature(signed, "GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"); err != nil {
+		t.Errorf("VerifyURISignature: %v", err)
+	}
+
+	if err := VerifyURISignature(signed, "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"); err == nil {
+		t.Errorf("signature should not verify with the wrong key")
+	}
+
+	parsed, err := ParseTxURI(signed)
+	if err != nil {
+		t.Fatalf("ParseTxURI: %v", err)
+	}
+
+	if parsed.XDR != xdr || parsed.Message != "please sign" || parsed.Signature == "" {
+		t.Errorf("bad round trip: %+v", parsed)
+	}
+
+	if _, err := New("test").SignTransaction(parsed.XDR, "SAJ4FP6H3FSTE4P7UOONX6ULQ4UKDMK7XXDDKGYTO6ZCRIF2ZU6LZM3D"); err != nil {
+		t.Errorf("SignTransaction: %v", err)
+	}
+}
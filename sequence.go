@@ -0,0 +1,128 @@
+package microstellar
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/stellar/go/build"
+	"github.com/stellar/go/xdr"
+)
+
+// SequenceTracker hands out sequence numbers for source accounts locally, so that transactions
+// can be built without a Horizon round-trip each, and concurrent transactions from the same
+// account don't race for the same sequence number. It fetches an account's sequence number from
+// Horizon the first time it's needed, and again after a submission fails with anything other
+// than an operation-level failure (which consumes the sequence number.)
+//
+// SequenceTracker implements build.SequenceProvider. To use it for all transactions from a
+// client, set the "track_sequences" parameter to true, or pass a tracker in the
+// "sequence_tracker" parameter to share it across clients. Clients aren't thread-safe, so use
+// one per goroutine:
+//
+//   params := microstellar.Params{"sequence_tracker": microstellar.NewSequenceTracker(nil)}
+//   go microstellar.New("test", params).PayNative(seed, address1, "1")
+//   go microstellar.New("test", params).PayNative(seed, address2, "1")
+//
+// Transactions that fail before they're submitted (e.g., on a missing memo or signature) make the
+// tracker resync. Transactions that are built but never signed or submitted leave gaps that cause
+// later transactions to fail with tx_bad_seq, after which the tracker resyncs.
+type SequenceTracker struct {
+	mu        sync.Mutex
+	provider  build.SequenceProvider
+	sequences map[string]xdr.SequenceNumber // last sequence number handed out
+}
+
+// NewSequenceTracker returns a SequenceTracker that fetches current sequence numbers from
+// provider. If provider is nil, the Tx that uses the tracker supplies its horizon client.
+func NewSequenceTracker(provider build.SequenceProvider) *SequenceTracker {
+	return &SequenceTracker{
+		provider:  provider,
+		sequences: map[string]xdr.SequenceNumber{},
+	}
+}
+
+// SequenceForAccount implements build.SequenceProvider. It returns the sequence number that the
+// next transaction from address should build on.
+func (st *SequenceTracker) SequenceForAccount(address string) (xdr.SequenceNumber, error) {
+	return st.next(address, st.provider)
+}
+
+// next allocates a sequence number for address, fetching it from provider if it's not known.
+// The fetch happens outside the lock, so that it doesn't hold up other accounts.
+func (st *SequenceTracker) next(address string, provider build.SequenceProvider) (xdr.SequenceNumber, error) {
+	if seq, ok := st.allocate(address, 0, false); ok {
+		return seq, nil
+	}
+
+	if provider == nil {
+		return 0, errors.Errorf("no sequence provider for %s", address)
+	}
+
+	debugf("SequenceTracker", "fetching sequence number for %s", address)
+	current, err := provider.SequenceForAccount(address)
+	if err != nil {
+		return 0, err
+	}
+
+	seq, _ := st.allocate(address, current, true)
+	return seq, nil
+}
+
+// allocate hands out the next sequence number for address. If address isn't known, it starts
+// from current if fetched is true, and fails otherwise. Concurrent fetches for the same account
+// return the same current sequence number, so whichever is stored first wins.
+func (st *SequenceTracker) allocate(address string, current xdr.SequenceNumber, fetched bool) (xdr.SequenceNumber, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	seq, ok := st.sequences[address]
+	if !ok {
+		if !fetched {
+			return 0, false
+		}
+
+		seq = current
+	}
+
+	st.sequences[address] = seq + 1
+	return seq, true
+}
+
+// Reset forgets the sequence number for address, so that it's fetched again for the next
+// transaction.
+func (st *SequenceTracker) Reset(address string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.sequences, address)
+}
+
+// trackedSequence is a build.SequenceProvider that allocates sequence numbers from tracker,
+// fetching unknown accounts from fallback if the tracker has no provider of its own.
+type trackedSequence struct {
+	tracker  *SequenceTracker
+	fallback build.SequenceProvider
+}
+
+// SequenceForAccount implements build.SequenceProvider.
+func (ts trackedSequence) SequenceForAccount(address string) (xdr.SequenceNumber, error) {
+	provider := ts.tracker.provider
+	if provider == nil {
+		provider = ts.fallback
+	}
+
+	return ts.tracker.next(address, provider)
+}
+
+// sequenceTrackerParam returns the tracker set in the "sequence_tracker" parameter, or a new one
+// if "track_sequences" is true, or nil.
+func sequenceTrackerParam(params Params) *SequenceTracker {
+	if tracker, ok := params["sequence_tracker"].(*SequenceTracker); ok {
+		return tracker
+	}
+
+	if track, _ := params["track_sequences"].(bool); track {
+		return NewSequenceTracker(nil)
+	}
+
+	return nil
+}
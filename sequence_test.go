@@ -0,0 +1,128 @@
+package microstellar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+func TestSequenceTracker(t *testing.T) {
+	var mu sync.Mutex
+	accountSeq := 100
+	badSeq := false
+	submitted := []int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/transactions" {
+			var envelope xdr.TransactionEnvelope
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			submitted = append(submitted, int(envelope.Tx.SeqNum))
+
+			if badSeq {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status": 400, "extras": {"result_codes": {"transaction": "tx_bad_seq"}}}`)
+				return
+			}
+
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "%d"}`, strings.TrimPrefix(r.URL.Path, "/accounts/"), accountSeq)
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test", "track_sequences": true})
+	pay := func() error {
+		return ms.PayNative(testOtherSeed, testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := New("custom", ms.params).PayNative(testOtherSeed, testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+				t.Errorf("payment failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, seq := range submitted {
+		seen[seq] = true
+	}
+
+	if !seen[101] || !seen[102] || !seen[103] {
+		t.Fatalf("want sequence numbers 101-103, got %v", submitted)
+	}
+
+	// Another account moved the sequence number: the next payment fails, and the tracker resyncs.
+	mu.Lock()
+	accountSeq, badSeq = 200, true
+	mu.Unlock()
+
+	if err := pay(); !IsBadSequence(err) {
+		t.Fatalf("want bad sequence error, got %v", err)
+	}
+
+	mu.Lock()
+	badSeq = false
+	mu.Unlock()
+
+	if err := pay(); err != nil {
+		t.Fatalf("payment failed: %v", err)
+	}
+
+	if got := submitted[len(submitted)-1]; got != 201 {
+		t.Errorf("want resynced sequence 201, got %d", got)
+	}
+}
+
+func TestSequenceTrackerResyncsOnLocalFailure(t *testing.T) {
+	memoAddress := "GAIUIQNMSXTTR4TGZETSQCGBTIF32G2L5P4AML4LFTMTHKM44UHIN6XQ"
+	submitted := []int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/transactions" {
+			var envelope xdr.TransactionEnvelope
+			xdr.SafeUnmarshalBase64(r.FormValue("tx"), &envelope)
+			submitted = append(submitted, int(envelope.Tx.SeqNum))
+			fmt.Fprint(w, `{"hash": "abcd", "ledger": 2}`)
+			return
+		}
+
+		address := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		if address == memoAddress {
+			fmt.Fprintf(w, `{"account_id": "%s", "sequence": "1", "data": {"%s": "MQ=="}}`, address, MemoRequiredDataKey)
+			return
+		}
+
+		fmt.Fprintf(w, `{"account_id": "%s", "sequence": "100"}`, address)
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test", "track_sequences": true})
+
+	// The destination requires a memo, so the payment fails before it's submitted.
+	if err := ms.PayNative(testOtherSeed, memoAddress, "1", Opts().SkipBalanceCheck()); err == nil {
+		t.Fatalf("want memo required error")
+	}
+
+	if err := ms.PayNative(testOtherSeed, testAddress, "1", Opts().SkipMemoRequiredCheck().SkipBalanceCheck()); err != nil {
+		t.Fatalf("payment failed: %v", err)
+	}
+
+	if len(submitted) != 1 || submitted[0] != 101 {
+		t.Errorf("want sequence 101 reused, got %v", submitted)
+	}
+}
@@ -0,0 +1,353 @@
+package microstellar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StatementEntry is a single change to an account's balance in a Statement.
+type StatementEntry struct {
+	ID      string    `json:"id"`      // paging token of the effect or transaction
+	Time    time.Time `json:"time"`    // ledger close time
+	Type    string    `json:"type"`    // horizon effect type (e.g., "account_credited", "trade"), or "fee"
+	Asset   *Asset    `json:"asset"`   // the asset whose balance changed
+	Amount  string    `json:"amount"`  // signed change, e.g., "-10.0000000"
+	Balance string    `json:"balance"` // running balance of Asset after the change
+	TxHash  string    `json:"tx_hash"` // set for fees
+}
+
+// StatementBalance is the opening and closing balance of an asset in a Statement.
+type StatementBalance struct {
+	Asset   *Asset `json:"asset"`
+	Opening string `json:"opening"`
+	Closing string `json:"closing"`
+}
+
+// Statement is the history of an account's balances over a period. See LoadStatement.
+type Statement struct {
+	Address  string             `json:"address"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Balances []StatementBalance `json:"balances"`
+	Entries  []StatementEntry   `json:"entries"`
+}
+
+// Formats supported by ExportStatement.
+const (
+	StatementCSV  = "csv"
+	StatementJSON = "json"
+)
+
+// statementPageLimit is the number of records requested per page of history.
+const statementPageLimit = 200
+
+// assetKey returns a string that identifies asset, for use as a map key.
+func assetKey(asset *Asset) string {
+	if asset.IsNative() {
+		return "native"
+	}
+
+	return asset.Code + ":" + asset.Issuer
+}
+
+// historyRecord holds the fields of the effect and transaction records used in statements.
+type historyRecord struct {
+	PagingToken string `json:"paging_token"`
+	Type        string `json:"type"`
+	CreatedAt   string `json:"created_at"`
+
+	// Effects.
+	Amount             string `json:"amount"`
+	StartingBalance    string `json:"starting_balance"`
+	AssetType          string `json:"asset_type"`
+	AssetCode          string `json:"asset_code"`
+	AssetIssuer        string `json:"asset_issuer"`
+	SoldAmount         string `json:"sold_amount"`
+	SoldAssetType      string `json:"sold_asset_type"`
+	SoldAssetCode      string `json:"sold_asset_code"`
+	SoldAssetIssuer    string `json:"sold_asset_issuer"`
+	BoughtAmount       string `json:"bought_amount"`
+	BoughtAssetType    string `json:"bought_asset_type"`
+	BoughtAssetCode    string `json:"bought_asset_code"`
+	BoughtAssetIssuer  string `json:"bought_asset_issuer"`
+	TransactionHash    string `json:"hash"`
+	TransactionAccount string `json:"source_account"`
+
+	// Transactions. Older horizons report fee_paid (a number), newer ones fee_charged (a
+	// number or string.)
+	FeePaid    json.RawMessage `json:"fee_paid"`
+	FeeCharged json.RawMessage `json:"fee_charged"`
+}
+
+// historyPage is a page of horizon records.
+type historyPage struct {
+	Links struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"_links"`
+	Embedded struct {
+		Records []historyRecord `json:"records"`
+	} `json:"_embedded"`
+}
+
+// walkHistory calls fn with every record in the collection at endpoint, in ascending order.
+func walkHistory(client *contextHTTP, endpoint string, fn func(record historyRecord) error) error {
+	next := endpoint + "?order=asc&limit=" + strconv.Itoa(statementPageLimit)
+	for next != "" {
+		debugf("walkHistory", "loading: %s", next)
+		resp, err := client.Get(next)
+		if err != nil {
+			return errors.Wrap(err, "could not load history")
+		}
+
+		var page historyPage
+		if resp.StatusCode != http.StatusOK {
+			err = errors.Errorf("could not load history: status %d", resp.StatusCode)
+		} else {
+			err = errors.Wrap(json.NewDecoder(resp.Body).Decode(&page), "could not decode history")
+		}
+		resp.Body.Close()
+
+		if err != nil {
+			return err
+		}
+
+		if len(page.Embedded.Records) == 0 {
+			break
+		}
+
+		for _, record := range page.Embedded.Records {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+
+		next = page.Links.Next.Href
+	}
+
+	return nil
+}
+
+// parseFee returns the fee in a fee_paid or fee_charged field, in stroops.
+func parseFee(raw json.RawMessage) (int64, bool) {
+	value := strings.Trim(string(raw), `"`)
+	if value == "" || value == "null" {
+		return 0, false
+	}
+
+	fee, err := strconv.ParseInt(value, 10, 64)
+	return fee, err == nil
+}
+
+// balanceChange is a change to a single asset's balance, before running balances are known.
+type balanceChange struct {
+	entry  StatementEntry
+	amount int64
+}
+
+// historyOrder returns the position of a record with pagingToken in the ledger's history.
+// Transaction tokens are transaction IDs, and effect tokens are "<operation ID>-<index>". An
+// operation's ID is its transaction's ID plus its index (from 1), so a transaction's fee orders
+// before the effects of its operations.
+func historyOrder(pagingToken string) (int64, int64) {
+	parts := strings.SplitN(pagingToken, "-", 2)
+	id, _ := strconv.ParseInt(parts[0], 10, 64)
+
+	var index int64
+	if len(parts) > 1 {
+		index, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+
+	return id, index
+}
+
+// LoadStatement walks the effects and transactions of address, and returns the running
+// balance of each asset, with every change between from (inclusive) and to (exclusive.)
+// Changes include payments, trades, account creation, and the fees paid by address. Opening
+// balances are computed from the account's full history.
+func (ms *MicroStellar) LoadStatement(address string, from time.Time, to time.Time, options ...*Options) (*Statement, error) {
+	if err := ValidAddress(address); err != nil {
+		return nil, ms.wrapf(err, "can't load statement")
+	}
+
+	statement := &Statement{Address: address, From: from, To: to, Balances: []StatementBalance{}, Entries: []StatementEntry{}}
+	if ms.fake {
+		return statement, ms.success()
+	}
+
+	tx := ms.queryTx(options)
+	client := tx.GetClient().HTTP.(*contextHTTP)
+	base := strings.TrimRight(tx.GetClient().URL, "/") + "/accounts/" + address
+
+	changes := []balanceChange{}
+	add := func(record historyRecord, entryType string, asset *Asset, amount string, sign int64) error {
+		value, err := ParseAmount(amount)
+		if err != nil {
+			return errors.Wrapf(err, "bad amount in %s %s", record.Type, record.PagingToken)
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, record.CreatedAt)
+		if err != nil {
+			return errors.Wrapf(err, "bad time in %s %s", record.Type, record.PagingToken)
+		}
+
+		changes = append(changes, balanceChange{
+			entry:  StatementEntry{ID: record.PagingToken, Time: createdAt, Type: entryType, Asset: asset, TxHash: record.TransactionHash},
+			amount: sign * value,
+		})
+		return nil
+	}
+
+	recordAsset := func(assetType, code, issuer string) *Asset {
+		return NewAsset(code, issuer, AssetType(assetType))
+	}
+
+	err := walkHistory(client, base+"/effects", func(record historyRecord) error {
+		switch record.Type {
+		case "account_created":
+			return add(record, record.Type, NativeAsset, record.StartingBalance, 1)
+		case "account_credited":
+			return add(record, record.Type, recordAsset(record.AssetType, record.AssetCode, record.AssetIssuer), record.Amount, 1)
+		case "account_debited":
+			return add(record, record.Type, recordAsset(record.AssetType, record.AssetCode, record.AssetIssuer), record.Amount, -1)
+		case "trade":
+			if err := add(record, record.Type, recordAsset(record.SoldAssetType, record.SoldAssetCode, record.SoldAssetIssuer), record.SoldAmount, -1); err != nil {
+				return err
+			}
+			return add(record, record.Type, recordAsset(record.BoughtAssetType, record.BoughtAssetCode, record.BoughtAssetIssuer), record.BoughtAmount, 1)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, ms.wrapf(err, "can't load effects")
+	}
+
+	err = walkHistory(client, base+"/transactions", func(record historyRecord) error {
+		if record.TransactionAccount != address {
+			return nil
+		}
+
+		fee, ok := parseFee(record.FeeCharged)
+		if !ok {
+			fee, ok = parseFee(record.FeePaid)
+		}
+
+		if !ok || fee == 0 {
+			return nil
+		}
+
+		return add(record, "fee", NativeAsset, ToAmountString(fee), -1)
+	})
+
+	if err != nil {
+		return nil, ms.wrapf(err, "can't load transactions")
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		iID, iIndex := historyOrder(changes[i].entry.ID)
+		jID, jIndex := historyOrder(changes[j].entry.ID)
+		if iID != jID {
+			return iID < jID
+		}
+		return iIndex < jIndex
+	})
+
+	balances := map[string]int64{}
+	opening := map[string]int64{}
+	assets := map[string]*Asset{}
+	order := []string{}
+
+	for _, change := range changes {
+		if !change.entry.Time.Before(to) {
+			break
+		}
+
+		key := assetKey(change.entry.Asset)
+		if _, ok := assets[key]; !ok {
+			assets[key] = change.entry.Asset
+			order = append(order, key)
+		}
+
+		balances[key] += change.amount
+		if change.entry.Time.Before(from) {
+			opening[key] = balances[key]
+			continue
+		}
+
+		change.entry.Amount = ToAmountString(change.amount)
+		change.entry.Balance = ToAmountString(balances[key])
+		statement.Entries = append(statement.Entries, change.entry)
+	}
+
+	for _, key := range order {
+		statement.Balances = append(statement.Balances, StatementBalance{
+			Asset:   assets[key],
+			Opening: ToAmountString(opening[key]),
+			Closing: ToAmountString(balances[key]),
+		})
+	}
+
+	return statement, ms.success()
+}
+
+// WriteCSV writes the statement's entries to w as CSV, with a header row.
+func (statement *Statement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "id", "type", "asset_code", "asset_issuer", "amount", "balance", "tx_hash"})
+
+	for _, entry := range statement.Entries {
+		code := entry.Asset.Code
+		if entry.Asset.IsNative() {
+			code = "XLM"
+		}
+
+		writer.Write([]string{
+			entry.Time.UTC().Format(time.RFC3339), entry.ID, entry.Type, code, entry.Asset.Issuer,
+			entry.Amount, entry.Balance, entry.TxHash,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportStatement returns the statement for address between from and to (see LoadStatement),
+// formatted as StatementCSV or StatementJSON.
+//
+//   from := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+//   csv, err := ms.ExportStatement("address", from, from.AddDate(0, 1, 0), microstellar.StatementCSV)
+func (ms *MicroStellar) ExportStatement(address string, from time.Time, to time.Time, format string, options ...*Options) ([]byte, error) {
+	if format != StatementCSV && format != StatementJSON {
+		return nil, ms.errorf("unsupported statement format: %s", format)
+	}
+
+	statement, err := ms.LoadStatement(address, from, to, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if format == StatementCSV {
+		err = statement.WriteCSV(&buf)
+	} else {
+		err = json.NewEncoder(&buf).Encode(statement)
+	}
+
+	if err != nil {
+		return nil, ms.wrapf(err, "can't format statement")
+	}
+
+	return buf.Bytes(), ms.success()
+}
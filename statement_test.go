@@ -0,0 +1,98 @@
+package microstellar
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadStatement(t *testing.T) {
+	address := testAddress
+	issuer := toAddress(testOtherSeed)
+
+	effects := []string{
+		`{"paging_token": "4294971393-1", "type": "account_created", "created_at": "2018-05-20T10:00:00Z", "starting_balance": "100.0000000"}`,
+		`{"paging_token": "8589938689-1", "type": "account_credited", "created_at": "2018-05-25T10:00:00Z", "amount": "0.1", "asset_type": "native"}`,
+		`{"paging_token": "12884905985-1", "type": "account_debited", "created_at": "2018-06-02T10:00:00Z", "amount": "10.5", "asset_type": "native"}`,
+		`{"paging_token": "17179873281-1", "type": "trade", "created_at": "2018-06-03T10:00:00Z",
+			"sold_amount": "20", "sold_asset_type": "native",
+			"bought_amount": "5", "bought_asset_type": "credit_alphanum4", "bought_asset_code": "USD", "bought_asset_issuer": "` + issuer + `"}`,
+		`{"paging_token": "21474840577-1", "type": "account_credited", "created_at": "2018-07-02T10:00:00Z", "amount": "1", "asset_type": "native"}`,
+	}
+
+	transactions := []string{
+		`{"paging_token": "12884905984", "hash": "tx1", "created_at": "2018-06-02T10:00:00Z", "source_account": "` + address + `", "fee_paid": 100}`,
+		`{"paging_token": "17179873280", "hash": "tx2", "created_at": "2018-06-03T10:00:00Z", "source_account": "` + address + `", "fee_charged": "200"}`,
+		`{"paging_token": "8589938688", "hash": "tx3", "created_at": "2018-05-25T10:00:00Z", "source_account": "` + issuer + `", "fee_paid": 100}`,
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		records := effects
+		if strings.HasSuffix(r.URL.Path, "/transactions") {
+			records = transactions
+		}
+
+		// Serve two records per page, to exercise paging.
+		start := 0
+		fmt.Sscanf(r.URL.Query().Get("cursor"), "%d", &start)
+		end := start + 2
+		if end > len(records) {
+			end = len(records)
+		}
+
+		if start >= len(records) {
+			records = nil
+		} else {
+			records = records[start:end]
+		}
+
+		fmt.Fprintf(w, `{"_links": {"next": {"href": "%s%s?order=asc&cursor=%d"}}, "_embedded": {"records": [%s]}}`,
+			server.URL, r.URL.Path, end, strings.Join(records, ","))
+	}))
+	defer server.Close()
+
+	ms := New("custom", Params{"url": server.URL, "passphrase": "test"})
+	from := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	statement, err := ms.LoadStatement(address, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("LoadStatement failed: %v", err)
+	}
+
+	want := []string{
+		"fee -0.0000100 100.0999900",
+		"account_debited -10.5000000 89.5999900",
+		"fee -0.0000200 89.5999700",
+		"trade -20.0000000 69.5999700",
+		"trade 5.0000000 5.0000000",
+	}
+
+	if len(statement.Entries) != len(want) {
+		t.Fatalf("want %d entries, got %+v", len(want), statement.Entries)
+	}
+
+	for i, entry := range statement.Entries {
+		if got := fmt.Sprintf("%s %s %s", entry.Type, entry.Amount, entry.Balance); got != want[i] {
+			t.Errorf("entry %d: want %s, got %s", i, want[i], got)
+		}
+	}
+
+	if len(statement.Balances) != 2 || statement.Balances[0].Opening != "100.1000000" || statement.Balances[0].Closing != "69.5999700" {
+		t.Errorf("bad balances: %+v", statement.Balances)
+	}
+
+	csv, err := ms.ExportStatement(address, from, from.AddDate(0, 1, 0), StatementCSV)
+	if err != nil || strings.Count(string(csv), "\n") != 6 || !strings.Contains(string(csv), ",fee,XLM,,-0.0000100,100.0999900,tx1") {
+		t.Errorf("bad CSV statement (%v):\n%s", err, csv)
+	}
+
+	data, err := ms.ExportStatement(address, from, from.AddDate(0, 1, 0), StatementJSON)
+	var decoded Statement
+	if err != nil || json.Unmarshal(data, &decoded) != nil || len(decoded.Entries) != 5 {
+		t.Errorf("bad JSON statement (%v): %s", err, data)
+	}
+}
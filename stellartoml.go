@@ -0,0 +1,231 @@
+package microstellar
+
+import (
+	"io"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/stellar/go/clients/stellartoml"
+)
+
+// stellarTOMLMaxSize is the maximum size of a stellar.toml file. Anchors that list many
+// currencies easily exceed the 5k limit used by the federation client.
+const stellarTOMLMaxSize = 100 * 1024
+
+// StellarTOML is the stellar.toml file published by a domain at /.well-known/stellar.toml. See
+// SEP-1 for details on the fields.
+type StellarTOML struct {
+	Version              string   `toml:"VERSION" json:"version"`
+	NetworkPassphrase    string   `toml:"NETWORK_PASSPHRASE" json:"network_passphrase"`
+	FederationServer     string   `toml:"FEDERATION_SERVER" json:"federation_server"`
+	AuthServer           string   `toml:"AUTH_SERVER" json:"auth_server"`
+	TransferServer       string   `toml:"TRANSFER_SERVER" json:"transfer_server"`
+	TransferServerSEP24  string   `toml:"TRANSFER_SERVER_SEP0024" json:"transfer_server_sep0024"`
+	KYCServer            string   `toml:"KYC_SERVER" json:"kyc_server"`
+	WebAuthEndpoint      string   `toml:"WEB_AUTH_ENDPOINT" json:"web_auth_endpoint"`
+	SigningKey           string   `toml:"SIGNING_KEY" json:"signing_key"`
+	HorizonURL           string   `toml:"HORIZON_URL" json:"horizon_url"`
+	Accounts             []string `toml:"ACCOUNTS" json:"accounts"`
+	URIRequestSigningKey string   `toml:"URI_REQUEST_SIGNING_KEY" json:"uri_request_signing_key"`
+
+	Documentation OrgDocumentation `toml:"DOCUMENTATION" json:"documentation"`
+	Currencies    []CurrencyInfo   `toml:"CURRENCIES" json:"currencies"`
+	Validators    []ValidatorInfo  `toml:"VALIDATORS" json:"validators"`
+}
+
+// OrgDocumentation is the DOCUMENTATION section of a stellar.toml file.
+type OrgDocumentation struct {
+	OrgName            string `toml:"ORG_NAME" json:"org_name"`
+	OrgDBA             string `toml:"ORG_DBA" json:"org_dba"`
+	OrgURL             string `toml:"ORG_URL" json:"org_url"`
+	OrgLogo            string `toml:"ORG_LOGO" json:"org_logo"`
+	OrgDescription     string `toml:"ORG_DESCRIPTION" json:"org_description"`
+	OrgPhysicalAddress string `toml:"ORG_PHYSICAL_ADDRESS" json:"org_physical_address"`
+	OrgOfficialEmail   string `toml:"ORG_OFFICIAL_EMAIL" json:"org_official_email"`
+	OrgSupportEmail    string `toml:"ORG_SUPPORT_EMAIL" json:"org_support_email"`
+}
+
+// CurrencyInfo is an entry in the CURRENCIES section of a stellar.toml file, and describes
+// an asset issued by the domain.
+type CurrencyInfo struct {
+	Code                   string `toml:"code" json:"code"`
+	CodeTemplate           string `toml:"code_template" json:"code_template"`
+	Issuer                 string `toml:"issuer" json:"issuer"`
+	Status                 string `toml:"status" json:"status"`
+	DisplayDecimals        int    `toml:"display_decimals" json:"display_decimals"`
+	Name                   string `toml:"name" json:"name"`
+	Desc                   string `toml:"desc" json:"desc"`
+	Conditions             string `toml:"conditions" json:"conditions"`
+	Image                  string `toml:"image" json:"image"`
+	FixedNumber            int64  `toml:"fixed_number" json:"fixed_number"`
+	MaxNumber              int64  `toml:"max_number" json:"max_number"`
+	IsUnlimited            bool   `toml:"is_unlimited" json:"is_unlimited"`
+	IsAssetAnchored        bool   `toml:"is_asset_anchored" json:"is_asset_anchored"`
+	AnchorAssetType        string `toml:"anchor_asset_type" json:"anchor_asset_type"`
+	AnchorAsset            string `toml:"anchor_asset" json:"anchor_asset"`
+	RedemptionInstructions string `toml:"redemption_instructions" json:"redemption_instructions"`
+	Regulated              bool   `toml:"regulated" json:"regulated"`
+	ApprovalServer         string `toml:"approval_server" json:"approval_server"`
+}
+
+// ValidatorInfo is an entry in the VALIDATORS section of a stellar.toml file, and describes
+// a stellar-core validator run by the domain.
+type ValidatorInfo struct {
+	Alias       string `toml:"ALIAS" json:"alias"`
+	DisplayName string `toml:"DISPLAY_NAME" json:"display_name"`
+	PublicKey   string `toml:"PUBLIC_KEY" json:"public_key"`
+	Host        string `toml:"HOST" json:"host"`
+	History     string `toml:"HISTORY" json:"history"`
+}
+
+// Asset returns the microstellar Asset for the currency.
+func (currency CurrencyInfo) Asset() *Asset {
+	return NewCreditAsset(currency.Code, currency.Issuer)
+}
+
+// GetCurrency returns the entry for asset in the CURRENCIES section, or nil if the asset is not listed.
+func (doc *StellarTOML) GetCurrency(asset *Asset) *CurrencyInfo {
+	for i, currency := range doc.Currencies {
+		if asset.Equals(*currency.Asset()) {
+			return &doc.Currencies[i]
+		}
+	}
+
+	return nil
+}
+
+// Validate returns an error if the document has malformed keys, accounts, currencies, or
+// non-HTTPS service endpoints.
+func (doc *StellarTOML) Validate() error {
+	for name, key := range map[string]string{
+		"SIGNING_KEY":             doc.SigningKey,
+		"URI_REQUEST_SIGNING_KEY": doc.URIRequestSigningKey,
+	} {
+		if key != "" {
+			if err := ValidAddress(key); err != nil {
+				return errors.Wrapf(err, "bad %s", name)
+			}
+		}
+	}
+
+	for name, endpoint := range map[string]string{
+		"FEDERATION_SERVER":       doc.FederationServer,
+		"AUTH_SERVER":             doc.AuthServer,
+		"TRANSFER_SERVER":         doc.TransferServer,
+		"TRANSFER_SERVER_SEP0024": doc.TransferServerSEP24,
+		"KYC_SERVER":              doc.KYCServer,
+		"WEB_AUTH_ENDPOINT":       doc.WebAuthEndpoint,
+	} {
+		if endpoint != "" && !strings.HasPrefix(endpoint, "https://") {
+			return errors.Errorf("%s must use https: %s", name, endpoint)
+		}
+	}
+
+	if doc.WebAuthEndpoint != "" && doc.SigningKey == "" {
+		return errors.Errorf("WEB_AUTH_ENDPOINT requires SIGNING_KEY")
+	}
+
+	for _, account := range doc.Accounts {
+		if err := ValidAddress(account); err != nil {
+			return errors.Wrapf(err, "bad account in ACCOUNTS: %s", account)
+		}
+	}
+
+	for _, currency := range doc.Currencies {
+		if currency.Code == "" && currency.CodeTemplate == "" {
+			return errors.Errorf("currency has no code")
+		}
+
+		if currency.Code != "" {
+			if err := currency.Asset().Validate(); err != nil {
+				return errors.Wrapf(err, "bad currency: %s", currency.Code)
+			}
+		}
+	}
+
+	for _, validator := range doc.Validators {
+		if err := ValidAddress(validator.PublicKey); err != nil {
+			return errors.Wrapf(err, "bad validator key: %s", validator.PublicKey)
+		}
+	}
+
+	return nil
+}
+
+// LoadStellarTOML fetches and parses the stellar.toml file published by domain.
+//
+//   doc, err := ms.LoadStellarTOML("stellar.org")
+//   log.Printf("federation server: %s", doc.FederationServer)
+func (ms *MicroStellar) LoadStellarTOML(domain string, options ...*Options) (*StellarTOML, error) {
+	debugf("LoadStellarTOML", "loading stellar.toml for: %s", domain)
+
+	var doc StellarTOML
+	if err := loadTOML(ms.httpClient(options), domain, &doc); err != nil {
+		return nil, ms.wrapf(err, "can't load stellar.toml for %s", domain)
+	}
+
+	return &doc, ms.success()
+}
+
+// LoadAssetInfo looks up the home domain of asset's issuer, and returns the entry for the asset published
+// in the domain's stellar.toml. Use this to check that an asset is legitimate before trusting it with
+// CreateTrustLine. Returns an error if the issuer has no home domain, or if the domain does not list the
+// asset.
+func (ms *MicroStellar) LoadAssetInfo(asset *Asset, options ...*Options) (*CurrencyInfo, error) {
+	if err := asset.Validate(); err != nil {
+		return nil, ms.wrapf(err, "can't load asset info")
+	}
+
+	if asset.IsNative() {
+		return nil, ms.errorf("can't load asset info for native assets")
+	}
+
+	account, err := ms.LoadAccount(asset.Issuer, options...)
+	if err != nil {
+		return nil, ms.wrapf(err, "can't load issuer")
+	}
+
+	if account.HomeDomain == "" {
+		return nil, ms.errorf("issuer %s has no home domain", asset.Issuer)
+	}
+
+	doc, err := ms.LoadStellarTOML(account.HomeDomain, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := doc.GetCurrency(asset)
+	if currency == nil {
+		return nil, ms.errorf("%s does not list asset %s issued by %s", account.HomeDomain, asset.Code, asset.Issuer)
+	}
+
+	return currency, ms.success()
+}
+
+// loadTOML fetches the stellar.toml file for domain and decodes it into v.
+func loadTOML(client *contextHTTP, domain string, v interface{}) error {
+	endpoint := "https://" + domain + stellartoml.WellKnownPath
+	debugf("loadTOML", "fetching: %s", endpoint)
+
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return errors.Wrap(err, "could not fetch stellar.toml")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("could not fetch stellar.toml: status %d", resp.StatusCode)
+	}
+
+	return decodeTOML(resp.Body, v)
+}
+
+// decodeTOML decodes a stellar.toml file from r into v.
+func decodeTOML(r io.Reader, v interface{}) error {
+	if _, err := toml.DecodeReader(io.LimitReader(r, stellarTOMLMaxSize), v); err != nil {
+		return errors.Wrap(err, "could not decode stellar.toml")
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package microstellar
+
+import (
+	"strings"
+	"testing"
+)
+
+const testStellarTOML = `
+VERSION="2.0.0"
+NETWORK_PASSPHRASE="Test SDF Network ; September 2015"
+FEDERATION_SERVER="https://example.com/federation"
+WEB_AUTH_ENDPOINT="https://example.com/auth"
+SIGNING_KEY="GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"
+ACCOUNTS=["GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"]
+
+[DOCUMENTATION]
+ORG_NAME="Example Org"
+
+[[CURRENCIES]]
+code="USD"
+issuer="GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"
+display_decimals=2
+is_asset_anchored=true
+anchor_asset_type="fiat"
+
+[[CURRENCIES]]
+code="EXAMPLECOIN"
+issuer="GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"
+
+[[VALIDATORS]]
+ALIAS="example"
+PUBLIC_KEY="GCR54Y3YDNEHIGOJW7KS7UPKTJTSF74IZWXBC5NHYQIYG5AIA7IL5I2T"
+`
+
+func TestStellarTOML(t *testing.T) {
+	var doc StellarTOML
+	if err := decodeTOML(strings.NewReader(testStellarTOML), &doc); err != nil {
+		t.Fatalf("decodeTOML: %v", err)
+	}
+
+	if err := doc.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	if doc.FederationServer != "https://example.com/federation" || doc.Documentation.OrgName != "Example Org" {
+		t.Errorf("bad document: %+v", doc)
+	}
+
+	if len(doc.Currencies) != 2 || len(doc.Validators) != 1 {
+		t.Fatalf("wrong number of currencies or validators: %+v", doc)
+	}
+
+	usd := NewAsset("USD", testAddress, Credit4Type)
+	if currency := doc.GetCurrency(usd); currency == nil || currency.DisplayDecimals != 2 || !currency.IsAssetAnchored {
+		t.Errorf("bad currency for USD: %+v", currency)
+	}
+
+	if currency := doc.GetCurrency(NewAsset("EXAMPLECOIN", testAddress, Credit12Type)); currency == nil {
+		t.Errorf("EXAMPLECOIN should be listed")
+	}
+
+	if currency := doc.GetCurrency(NewAsset("EUR", testAddress, Credit4Type)); currency != nil {
+		t.Errorf("EUR should not be listed")
+	}
+
+	doc.FederationServer = "http://example.com/federation"
+	if err := doc.Validate(); err == nil {
+		t.Errorf("non-https endpoint should fail validation")
+	}
+
+	doc.FederationServer = ""
+	doc.SigningKey = "BADKEY"
+	if err := doc.Validate(); err == nil {
+		t.Errorf("bad signing key should fail validation")
+	}
+}
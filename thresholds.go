@@ -0,0 +1,164 @@
+package microstellar
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+)
+
+// ThresholdCategory is the signing threshold (low, medium, or high) that an operation
+// falls under. The signers on a transaction must have a combined weight of at least the
+// source account's threshold for the category.
+type ThresholdCategory int
+
+// The threshold categories for operations.
+const (
+	ThresholdLow    = ThresholdCategory(0) // AllowTrust, BumpSequence, Inflation
+	ThresholdMedium = ThresholdCategory(1) // Everything else
+	ThresholdHigh   = ThresholdCategory(2) // AccountMerge, and SetOptions that change signers or thresholds
+)
+
+// String returns the name of the threshold category.
+func (category ThresholdCategory) String() string {
+	switch category {
+	case ThresholdLow:
+		return "low"
+	case ThresholdMedium:
+		return "medium"
+	case ThresholdHigh:
+		return "high"
+	}
+
+	return "unknown"
+}
+
+// OperationThreshold returns the threshold category that op falls under.
+func OperationThreshold(op xdr.Operation) ThresholdCategory {
+	switch op.Body.Type {
+	case xdr.OperationTypeAllowTrust, xdr.OperationTypeBumpSequence, xdr.OperationTypeInflation:
+		return ThresholdLow
+	case xdr.OperationTypeAccountMerge:
+		return ThresholdHigh
+	case xdr.OperationTypeSetOptions:
+		so := op.Body.SetOptionsOp
+		if so != nil && (so.MasterWeight != nil || so.Signer != nil ||
+			so.LowThreshold != nil || so.MedThreshold != nil || so.HighThreshold != nil) {
+			return ThresholdHigh
+		}
+	}
+
+	return ThresholdMedium
+}
+
+// GetThreshold returns the account's threshold value for category.
+func (account *Account) GetThreshold(category ThresholdCategory) byte {
+	switch category {
+	case ThresholdLow:
+		return account.Thresholds.Low
+	case ThresholdHigh:
+		return account.Thresholds.High
+	}
+
+	return account.Thresholds.Medium
+}
+
+// RequiredWeight returns the minimum combined signer weight needed to authorize operations
+// of the given category on this account. The network always requires at least one valid
+// signature, so this is never less than 1.
+func (account *Account) RequiredWeight(category ThresholdCategory) int32 {
+	threshold := int32(account.GetThreshold(category))
+	if threshold < 1 {
+		return 1
+	}
+
+	return threshold
+}
+
+// SignerWeight returns the combined weight of the signers on the account that
+// match addresses. Addresses that are not signers on the account are ignored.
+func (account *Account) SignerWeight(addresses ...string) int32 {
+	seen := map[string]bool{}
+	weight := int32(0)
+
+	for _, address := range addresses {
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		for _, s := range account.Signers {
+			if s.PublicKey == address || s.Key == address {
+				weight += s.Weight
+				break
+			}
+		}
+	}
+
+	return weight
+}
+
+// Thresholds returns the highest threshold category required on each source account
+// in the built transaction, keyed by address. The transaction's source account always
+// requires at least a low threshold to pay the fee and consume the sequence number.
+func (tx *Tx) Thresholds() (map[string]ThresholdCategory, error) {
+	if tx.builder == nil || tx.builder.TX == nil {
+		return nil, errors.Errorf("transaction not built")
+	}
+
+	txSource := tx.builder.TX.SourceAccount.Address()
+	categories := map[string]ThresholdCategory{txSource: ThresholdLow}
+
+	for _, op := range tx.builder.TX.Operations {
+		source := txSource
+		if op.SourceAccount != nil {
+			source = op.SourceAccount.Address()
+		}
+
+		if category := OperationThreshold(op); category > categories[source] {
+			categories[source] = category
+		}
+	}
+
+	return categories, nil
+}
+
+// checkThresholds loads each source account in the built transaction and makes sure that
+// the signing keys in seeds carry enough weight for the queued operations.
+func (tx *Tx) checkThresholds(seeds []string) error {
+	categories, err := tx.Thresholds()
+	if err != nil {
+		return errors.Wrap(err, "can't check thresholds")
+	}
+
+	addresses := []string{}
+	for _, seed := range seeds {
+		kp, err := keypair.Parse(seed)
+		if err != nil {
+			return errors.Wrapf(err, "can't check thresholds: bad signer")
+		}
+
+		// Only full keypairs can produce signatures.
+		if _, ok := kp.(*keypair.Full); ok {
+			addresses = append(addresses, kp.Address())
+		}
+	}
+
+	for address, category := range categories {
+		debugf("Tx.checkThresholds", "checking %s threshold on %s", category, address)
+		ha, err := loadHorizonAccount(tx.client, address)
+		if err != nil {
+			return errors.Wrapf(err, "can't check thresholds: could not load account %s", address)
+		}
+
+		account := newAccountFromHorizon(ha)
+		have := account.SignerWeight(addresses...)
+		need := account.RequiredWeight(category)
+
+		if have < need {
+			return errors.Errorf("insufficient signing weight on %s for %s threshold operations: have %d, need %d",
+				address, category, have, need)
+		}
+	}
+
+	return nil
+}
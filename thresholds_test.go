@@ -0,0 +1,104 @@
+package microstellar
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/build"
+	"github.com/stellar/go/keypair"
+)
+
+func TestOperationThreshold(t *testing.T) {
+	const address = "GAB6FX3WVKZZRUE64H77BRWLDIOIOR4MU27L3ATNVUYKXPX5GF22TOZO"
+
+	builder, err := build.Transaction(
+		build.SourceAccount{AddressOrSeed: address},
+		build.TestNetwork,
+		build.Sequence{Sequence: 1},
+		build.Payment(build.Destination{AddressOrSeed: address}, build.NativeAmount{Amount: "1"}),
+		build.AllowTrust(build.Trustor{Address: address}, build.AllowTrustAsset{Code: "USD"}, build.Authorize{Value: true}),
+		build.HomeDomain("qubit.sh"),
+		build.MasterWeight(0),
+		build.SetThresholds(1, 2, 3),
+		build.AccountMerge(build.Destination{AddressOrSeed: address}),
+	)
+
+	if err != nil {
+		t.Fatalf("could not build transaction: %v", err)
+	}
+
+	want := []ThresholdCategory{ThresholdMedium, ThresholdLow, ThresholdMedium, ThresholdHigh, ThresholdHigh, ThresholdHigh}
+	for i, op := range builder.TX.Operations {
+		if got := OperationThreshold(op); got != want[i] {
+			t.Errorf("op %d (%v): want %v, got %v", i, op.Body.Type, want[i], got)
+		}
+	}
+}
+
+func TestSignerWeight(t *testing.T) {
+	account := &Account{
+		Signers: []Signer{
+			{PublicKey: "GA", Weight: 1},
+			{PublicKey: "GB", Weight: 2},
+		},
+		Thresholds: Thresholds{Low: 0, Medium: 2, High: 3},
+	}
+
+	if weight := account.SignerWeight("GA", "GA", "GC"); weight != 1 {
+		t.Errorf("duplicate and unknown signers should be ignored: want 1, got %v", weight)
+	}
+
+	if weight := account.SignerWeight("GA", "GB"); weight != 3 {
+		t.Errorf("wrong signer weight: want 3, got %v", weight)
+	}
+
+	if weight := account.RequiredWeight(ThresholdLow); weight != 1 {
+		t.Errorf("zero thresholds need at least one signature: want 1, got %v", weight)
+	}
+
+	if weight := account.RequiredWeight(ThresholdHigh); weight != 3 {
+		t.Errorf("wrong required weight: want 3, got %v", weight)
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	seed := testOtherSeed
+	pair, _ := keypair.Parse(seed)
+	address := pair.Address()
+
+	server := newFakeHorizon(func(string) (string, bool) {
+		return fmt.Sprintf(`"thresholds": {"low_threshold": 1, "med_threshold": 1, "high_threshold": 2},
+			"signers": [{"public_key": "%s", "weight": 1}]`, address), true
+	}, nil)
+	defer server.Close()
+
+	newTx := func() *Tx {
+		tx := NewTx("custom", Params{"url": server.URL, "passphrase": "test"})
+		tx.SetOptions(Opts().CheckThresholds())
+		return tx
+	}
+
+	tx := newTx()
+	if err := tx.Build(sourceAccount(seed), build.SetData("foo", []byte("bar"))); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	if err := tx.Sign(seed); err != nil {
+		t.Errorf("medium threshold op should be signable: %v", err)
+	}
+
+	tx = newTx()
+	if err := tx.Build(sourceAccount(seed), build.MasterWeight(0)); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	err := tx.Sign(seed)
+	if err == nil || !strings.Contains(err.Error(), "insufficient signing weight") {
+		t.Errorf("high threshold op should fail: got %v", err)
+	}
+
+	if tx.IsSigned() {
+		t.Errorf("transaction should not be signed")
+	}
+}
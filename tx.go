@@ -1,7 +1,9 @@
 package microstellar
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -30,7 +32,12 @@ type Tx struct {
 	response      *horizon.TransactionSuccess
 	isMultiOp     bool                       // is this a multi-op transaction
 	ops           []build.TransactionMutator // all ops for multi-op
+	opMethods     []string                   // microstellar method that queued each op
 	sourceAccount string
+	httpClient    *http.Client           // HTTP client for horizon requests
+	timeout       time.Duration          // per-request timeout for the horizon client
+	pool          *horizonPool           // horizon instances to fail over between, if more than one
+	sequences     build.SequenceProvider // custom sequence number source, if set
 	err           error
 }
 
@@ -48,6 +55,20 @@ type Tx struct {
 //    NewTx("custom", Params{
 //        "url": "https://my-horizon-server.com",
 //        "passphrase": "foobar"})
+//
+// To spread load across several horizon instances of the same network, pass
+// them in "urls" instead of "url". This works for any network: on "public" and
+// "test", "urls" replaces the default horizon server, even with a single entry.
+// Requests go to a healthy instance, and fail over to the others if it's
+// unreachable or unavailable. An instance is healthy if its root endpoint
+// responds and it's no more than "max_ledger_lag" ledgers (default 10) behind
+// the newest instance. Health is checked every "health_interval" (default 30s)
+// with the "http_client", "headers", and "middleware" parameters. All the
+// transactions created by a MicroStellar client share health state.
+//
+//    NewTx("custom", Params{
+//        "urls": []string{"https://horizon1.example.com", "https://horizon2.example.com"},
+//        "passphrase": "foobar"})
 func NewTx(networkName string, params ...Params) *Tx {
 	var network build.Network
 	var client *horizon.Client
@@ -74,6 +95,10 @@ func NewTx(networkName string, params ...Params) *Tx {
 		url, ok1 := params[0]["url"]
 		passphrase, ok2 := params[0]["passphrase"]
 
+		if urls := urlsParam(params[0]); len(urls) > 0 {
+			url, ok1 = urls[0], true
+		}
+
 		if !(ok1 && ok2) {
 			logrus.Errorf("missing url or passphrase, connecting to testnet")
 			return NewTx("test")
@@ -81,8 +106,7 @@ func NewTx(networkName string, params ...Params) *Tx {
 
 		network = build.Network{Passphrase: passphrase.(string)}
 		client = &horizon.Client{
-			URL:  url.(string),
-			HTTP: http.DefaultClient,
+			URL: url.(string),
 		}
 	default:
 		// use the test network
@@ -90,9 +114,48 @@ func NewTx(networkName string, params ...Params) *Tx {
 		client = horizon.DefaultTestNetClient
 	}
 
+	var p Params
+	if len(params) > 0 {
+		p = params[0]
+	}
+
+	httpClient := newHorizonHTTPClient(p)
+	timeout := durationParam(p, "timeout", 0)
+
+	if limiter := rateLimiterParam(p); limiter != nil {
+		httpClient = withRateLimit(httpClient, limiter)
+	}
+
+	var sequences build.SequenceProvider
+	if tracker := sequenceTrackerParam(p); tracker != nil {
+		sequences = tracker
+	}
+
+	var pool *horizonPool
+	if !fake {
+		if urls := urlsParam(p); len(urls) == 1 {
+			client = &horizon.Client{URL: urls[0]}
+		}
+
+		if pool = horizonPoolParam(p); pool != nil {
+			httpClient = withFailover(httpClient, pool)
+			client = &horizon.Client{URL: pool.base()}
+		}
+	}
+
+	// Use a private client so that contexts and timeouts don't leak to other transactions.
+	client = &horizon.Client{
+		URL:  client.URL,
+		HTTP: newContextHTTP(httpClient, nil, timeout),
+	}
+
 	return &Tx{
 		networkName: networkName,
 		client:      client,
+		httpClient:  httpClient,
+		timeout:     timeout,
+		pool:        pool,
+		sequences:   sequences,
 		network:     network,
 		fake:        fake,
 		options:     nil,
@@ -109,6 +172,10 @@ func NewTx(networkName string, params ...Params) *Tx {
 // SetOptions sets the Tx options
 func (tx *Tx) SetOptions(options *Options) {
 	tx.options = options
+	if options.ctx != nil {
+		tx.setContext(options.ctx)
+	}
+
 	if options.isMultiOp {
 		tx.Start(options.multiOpSource)
 	}
@@ -120,6 +187,42 @@ func (tx *Tx) WithOptions(options *Options) *Tx {
 	return tx
 }
 
+// setContext makes all horizon requests made by tx use ctx.
+func (tx *Tx) setContext(ctx context.Context) {
+	tx.client = &horizon.Client{
+		URL:  tx.client.URL,
+		HTTP: newContextHTTP(tx.httpClient, ctx, tx.timeout),
+	}
+}
+
+// SetSequenceProvider makes tx use provider (e.g., a SequenceTracker) for source account
+// sequence numbers instead of loading them from Horizon. Call it before building the
+// transaction.
+func (tx *Tx) SetSequenceProvider(provider build.SequenceProvider) {
+	tx.sequences = provider
+}
+
+// autoSequence returns the mutator that sets the transaction's sequence number.
+func (tx *Tx) autoSequence() build.AutoSequence {
+	switch provider := tx.sequences.(type) {
+	case nil:
+		return build.AutoSequence{SequenceProvider: tx.client}
+	case *SequenceTracker:
+		return build.AutoSequence{SequenceProvider: trackedSequence{tracker: provider, fallback: tx.client}}
+	default:
+		return build.AutoSequence{SequenceProvider: provider}
+	}
+}
+
+// builtTx returns the built transaction, or nil if tx hasn't been built.
+func (tx *Tx) builtTx() *xdr.Transaction {
+	if tx.builder == nil {
+		return nil
+	}
+
+	return tx.builder.TX
+}
+
 // GetClient returns the underlying horizon client handle.
 func (tx *Tx) GetClient() *horizon.Client {
 	return tx.client
@@ -180,6 +283,7 @@ func (tx *Tx) Reset() {
 	tx.submitted = false
 	tx.response = nil
 	tx.isMultiOp = false
+	tx.opMethods = nil
 	tx.err = nil
 }
 
@@ -194,13 +298,25 @@ func (tx *Tx) Start(account string) *Tx {
 	tx.ops = []build.TransactionMutator{
 		build.TransactionMutator(sourceAccount),
 		tx.network,
-		build.AutoSequence{SequenceProvider: tx.client},
+		tx.autoSequence(),
 	}
+	tx.opMethods = nil
 	tx.isMultiOp = true
 
 	return tx
 }
 
+// buildOp builds the single operation queued by the microstellar method named method, so that
+// operation-level errors can be traced back to the call that queued the operation.
+func (tx *Tx) buildOp(method string, sourceAccount build.TransactionMutator, op build.TransactionMutator) error {
+	if err := tx.Build(sourceAccount, op); err != nil {
+		return err
+	}
+
+	tx.opMethods = append(tx.opMethods, method)
+	return nil
+}
+
 // Build creates a new operation out of the provided mutators.
 func (tx *Tx) Build(sourceAccount build.TransactionMutator, muts ...build.TransactionMutator) error {
 	if tx.err != nil {
@@ -240,19 +356,58 @@ func (tx *Tx) Build(sourceAccount build.TransactionMutator, muts ...build.Transa
 	if tx.isMultiOp {
 		tx.ops = append(tx.ops, muts...)
 	} else {
+		txSource := sourceAccount
+		if tx.options != nil && tx.options.channelSeed != "" {
+			txSource = build.SourceAccount{AddressOrSeed: tx.options.channelSeed}
+		}
+
 		muts = append([]build.TransactionMutator{
-			sourceAccount,
+			txSource,
 			tx.network,
-			build.AutoSequence{SequenceProvider: tx.client},
+			tx.autoSequence(),
 		}, muts...)
 
 		builder, err := build.Transaction(muts...)
+		if err != nil {
+			// The builder is discarded, so give back the sequence number by source address.
+			if source, ok := txSource.(build.SourceAccount); ok {
+				tx.resetSequence(toAddress(source.AddressOrSeed))
+			}
+
+			tx.err = errors.Wrap(err, "could not build transaction")
+			return tx.err
+		}
+
 		tx.builder = builder
-		tx.err = errors.Wrap(err, "could not build transaction")
+		if txSource != sourceAccount {
+			if err := tx.setOpSource(sourceAccount); err != nil {
+				return tx.abort(errors.Wrap(err, "could not build transaction"))
+			}
+		}
 	}
 	return tx.err
 }
 
+// setOpSource sets the source account of all operations that don't have one to source. Use
+// this when the transaction source (e.g., a channel account) differs from the account the
+// operations act on.
+func (tx *Tx) setOpSource(source build.TransactionMutator) error {
+	mutator, ok := source.(build.OperationMutator)
+	if !ok {
+		return errors.Errorf("can't use %T as an operation source", source)
+	}
+
+	for i := range tx.builder.TX.Operations {
+		if tx.builder.TX.Operations[i].SourceAccount == nil {
+			if err := mutator.MutateOperation(&tx.builder.TX.Operations[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // IsSigned returns true of the transaction is signed.
 func (tx *Tx) IsSigned() bool {
 	return tx.payload != ""
@@ -284,6 +439,19 @@ func (tx *Tx) Sign(keys ...string) error {
 
 	if tx.isMultiOp {
 		tx.builder, err = build.Transaction(tx.ops...)
+		if err != nil {
+			tx.resetSequence(toAddress(tx.sourceAccount))
+			tx.err = errors.Wrap(err, "could not build transaction")
+			return tx.err
+		}
+	}
+
+	// Check for SEP-29 memos before signing, so that unsigned envelopes (e.g., for offline
+	// signing) are checked too.
+	if tx.options == nil || !tx.options.skipMemoRequiredCheck {
+		if err = tx.checkMemoRequired(); err != nil {
+			return tx.abort(err)
+		}
 	}
 
 	if tx.options != nil && tx.options.skipSignatures {
@@ -292,17 +460,25 @@ func (tx *Tx) Sign(keys ...string) error {
 	} else {
 		debugf("Tx.Sign", "signing transaction, seq: %v", tx.builder.TX.SeqNum)
 		if tx.options != nil && len(tx.options.signerSeeds) > 0 {
-			txe, err = tx.builder.Sign(tx.options.signerSeeds...)
-		} else {
-			if len(keys) == 0 {
-				keys = []string{tx.sourceAccount}
+			keys = tx.options.signerSeeds
+		} else if len(keys) == 0 {
+			keys = []string{tx.sourceAccount}
+		}
+
+		if tx.options != nil && tx.options.channelSeed != "" && !tx.isMultiOp {
+			keys = append(append([]string{}, keys...), tx.options.channelSeed)
+		}
+
+		if tx.options != nil && tx.options.checkThresholds {
+			if err = tx.checkThresholds(keys); err != nil {
+				return tx.abort(err)
 			}
-			txe, err = tx.builder.Sign(keys...)
 		}
 
+		txe, err = tx.builder.Sign(keys...)
+
 		if err != nil {
-			tx.err = errors.Wrap(err, "signing error")
-			return tx.err
+			return tx.abort(errors.Wrap(err, "signing error"))
 		}
 	}
 
@@ -310,13 +486,46 @@ func (tx *Tx) Sign(keys ...string) error {
 	debugf("Tx.Sign", "signed transaction, payload: %s", tx.payload)
 
 	if err != nil {
-		tx.err = errors.Wrap(err, "base64 conversion error")
-		return tx.err
+		return tx.abort(errors.Wrap(err, "base64 conversion error"))
 	}
 
 	return nil
 }
 
+// resyncSequence makes a SequenceTracker refetch the source account's sequence number after
+// a failed submission, unless the transaction made it into the ledger (and consumed its
+// sequence number) with failed operations.
+func (tx *Tx) resyncSequence(err error) {
+	if tx.builder == nil || tx.builder.TX == nil {
+		return
+	}
+
+	if txErr := AsTxError(err); txErr != nil && txErr.TxCode == "tx_failed" {
+		return
+	}
+
+	tx.resetSequence(tx.builder.TX.SourceAccount.Address())
+}
+
+// resetSequence makes a SequenceTracker refetch the sequence number of address.
+func (tx *Tx) resetSequence(address string) {
+	tracker, ok := tx.sequences.(*SequenceTracker)
+	if !ok || address == "" {
+		return
+	}
+
+	debugf("Tx.resetSequence", "resyncing sequence number for %s", address)
+	tracker.Reset(address)
+}
+
+// abort fails tx with err after it's built but before it's submitted. The transaction's
+// sequence number is never used, so a SequenceTracker must refetch it.
+func (tx *Tx) abort(err error) error {
+	tx.resyncSequence(err)
+	tx.err = err
+	return tx.err
+}
+
 // Submit sends the transaction to the stellar network.
 func (tx *Tx) Submit() error {
 	if tx.err != nil {
@@ -346,6 +555,7 @@ func (tx *Tx) Submit() error {
 			}
 
 			if !cont {
+				tx.resyncSequence(nil)
 				return nil
 			}
 		}
@@ -361,7 +571,9 @@ func (tx *Tx) Submit() error {
 
 	if err != nil {
 		debugf("Tx.Submit", "submit failed: %s", ErrorString(err))
-		tx.err = errors.Wrap(err, "could not submit transaction")
+		txErr := newTxError(err, tx.opMethods)
+		tx.resyncSequence(txErr)
+		tx.err = errors.Wrap(txErr, "could not submit transaction")
 		return tx.err
 	}
 
@@ -82,8 +82,25 @@ func ErrorString(err error, showStackTrace ...bool) string {
 
 // FundWithFriendBot funds address on the test network with some initial funds.
 func FundWithFriendBot(address string) (string, error) {
+	return fundWithFriendBot(http.DefaultClient, address)
+}
+
+// FundWithFriendBot funds address on the test network with some initial funds. Unlike the
+// package-level FundWithFriendBot, the request is sent with the HTTP client, headers, and
+// middleware configured in New, and honours Options.WithContext.
+func (ms *MicroStellar) FundWithFriendBot(address string, options ...*Options) (string, error) {
+	body, err := fundWithFriendBot(ms.httpClient(options), address)
+	if err != nil {
+		return "", ms.wrapf(err, "friendbot request failed")
+	}
+
+	return body, ms.success()
+}
+
+// fundWithFriendBot asks friendbot to fund address, using client.
+func fundWithFriendBot(client httpGetter, address string) (string, error) {
 	debugf("FundWithFriendBot", "funding address: %s", address)
-	resp, err := http.Get("https://friendbot.stellar.org/?addr=" + address)
+	resp, err := client.Get("https://friendbot.stellar.org/?addr=" + address)
 	if err != nil {
 		return "", err
 	}
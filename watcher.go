@@ -2,6 +2,7 @@ package microstellar
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -46,10 +47,20 @@ func (ms *MicroStellar) WatchLedgers(options ...*Options) (*LedgerWatcher, error
 			return
 		}
 
-		err := params.tx.GetClient().StreamLedgers(params.ctx, params.cursor, func(ledger horizon.Ledger) {
-			debugf("WatchLedger", "entry (%s) total_coins: %s, tx_count: %v, op_count: %v", ledger.ID, ledger.TotalCoins, ledger.TransactionCount, ledger.OperationCount)
-			l := Ledger(ledger)
-			w.Ch <- &l
+		err := params.tx.stream(params.ctx, params.cursor, func(client *horizon.Client, cursor *horizon.Cursor, seen func(string)) error {
+			return params.tx.streamEvents(params.ctx, client.URL+"/ledgers", cursor, func(data []byte) error {
+				var ledger horizon.Ledger
+				if err := json.Unmarshal(data, &ledger); err != nil {
+					return errors.Wrap(err, "could not parse ledger")
+				}
+
+				debugf("WatchLedger", "entry (%s) total_coins: %s, tx_count: %v, op_count: %v", ledger.ID, ledger.TotalCoins, ledger.TransactionCount, ledger.OperationCount)
+				seen(ledger.PT)
+				ms.invalidateLedger()
+				l := Ledger(ledger)
+				w.Ch <- &l
+				return nil
+			})
 		})
 
 		if err != nil {
@@ -95,10 +106,20 @@ func (ms *MicroStellar) WatchTransactions(address string, options ...*Options) (
 			return
 		}
 
-		err := params.tx.GetClient().StreamTransactions(params.ctx, params.address, params.cursor, func(transaction horizon.Transaction) {
-			debugf("WatchTransaction", "found transaction (%s) on %s", transaction.ID, transaction.Account)
-			t := Transaction(transaction)
-			w.Ch <- &t
+		err := params.tx.stream(params.ctx, params.cursor, func(client *horizon.Client, cursor *horizon.Cursor, seen func(string)) error {
+			endpoint := fmt.Sprintf("%s/accounts/%s/transactions", client.URL, params.address)
+			return params.tx.streamEvents(params.ctx, endpoint, cursor, func(data []byte) error {
+				var transaction horizon.Transaction
+				if err := json.Unmarshal(data, &transaction); err != nil {
+					return errors.Wrap(err, "could not parse transaction")
+				}
+
+				debugf("WatchTransaction", "found transaction (%s) on %s", transaction.ID, transaction.Account)
+				seen(transaction.PT)
+				t := Transaction(transaction)
+				w.Ch <- &t
+				return nil
+			})
 		})
 
 		if err != nil {
@@ -144,11 +165,21 @@ func (ms *MicroStellar) WatchPayments(address string, options ...*Options) (*Pay
 			return
 		}
 
-		err := params.tx.GetClient().StreamPayments(params.ctx, params.address, params.cursor, func(payment horizon.Payment) {
-			debugf("WatchPayments", "found payment (%s) at %s, loading memo", payment.Type, address)
-			params.tx.GetClient().LoadMemo(&payment)
-			p := Payment(payment)
-			w.Ch <- &p
+		err := params.tx.stream(params.ctx, params.cursor, func(client *horizon.Client, cursor *horizon.Cursor, seen func(string)) error {
+			endpoint := fmt.Sprintf("%s/accounts/%s/payments", client.URL, params.address)
+			return params.tx.streamEvents(params.ctx, endpoint, cursor, func(data []byte) error {
+				var payment horizon.Payment
+				if err := json.Unmarshal(data, &payment); err != nil {
+					return errors.Wrap(err, "could not parse payment")
+				}
+
+				debugf("WatchPayments", "found payment (%s) at %s, loading memo", payment.Type, address)
+				seen(payment.PagingToken)
+				params.tx.GetClient().LoadMemo(&payment)
+				p := Payment(payment)
+				w.Ch <- &p
+				return nil
+			})
 		})
 
 		if err != nil {